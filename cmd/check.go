@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os"
-	"time"
+	"sort"
+	"sync"
 
 	"github.com/mrlyc/heracles/core"
 	"github.com/mrlyc/heracles/log"
@@ -11,135 +13,247 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
-	"go.uber.org/dig"
 )
 
+// groupMarkers are the keys of which a config group declares at least one, other top-level maps are
+// not groups.
+var groupMarkers = []string{"metrics", "compose_file", "process", "base_url"}
+
+// isGroup returns true if a top-level config value is a group to check.
+func isGroup(value interface{}) bool {
+	settings, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	for _, key := range groupMarkers {
+		if _, ok := settings[key]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkGroups returns the config groups selected by the --group and --all flags, a group with a
+// matrix is expanded into the virtual groups of its cells.
+func checkGroups(flags *pflag.FlagSet) ([]string, error) {
+	var groups []string
+	all, _ := flags.GetBool("all")
+	if all {
+		for key, value := range viper.AllSettings() {
+			if isGroup(value) {
+				groups = append(groups, key)
+			}
+		}
+		sort.Strings(groups)
+	} else {
+		groups, _ = flags.GetStringSlice("group")
+	}
+
+	expanded := make([]string, 0, len(groups))
+	for _, group := range groups {
+		config := viper.Sub(group)
+		if _, cell := core.ParseMatrixGroup(group); config == nil || len(cell) != 0 {
+			expanded = append(expanded, group)
+			continue
+		}
+
+		var variables []core.MatrixVariable
+		err := config.UnmarshalKey("matrix", &variables)
+		if err != nil {
+			return nil, eris.Wrapf(err, "matrix of group %s unmarshaling failed", group)
+		}
+
+		cells, err := core.ExpandMatrix(variables)
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid matrix of group %s", group)
+		}
+
+		if len(cells) == 0 {
+			expanded = append(expanded, group)
+		}
+
+		for _, cell := range cells {
+			expanded = append(expanded, core.MatrixGroup(group, cell))
+		}
+	}
+
+	return expanded, nil
+}
+
+// checkGroup runs the checks of a config group and returns its report and report file.
+func checkGroup(ctx context.Context, cmd *cobra.Command, group string) (report *core.CheckReport, reportFile string, err error) {
+	container := newContainer(ctx, cmd, group)
+
+	err = container.Invoke(func(
+		ctx context.Context, checker *core.MetricChecker, compose *core.DockerCompose, process *core.ProcessExporter,
+		config *viper.Viper,
+	) error {
+		reportFile = config.GetString("report_file")
+
+		var checkErr error
+		report, checkErr = checker.Check(ctx)
+
+		if checker.Kept() {
+			logger := log.FromContext(ctx)
+			if compose != nil {
+				logger.Warnf("the stack of group %s is kept, compose project: %s", group, compose.ProjectName)
+			} else {
+				logger.Warnf("the fixtures of group %s are kept", group)
+			}
+			if checker.BaseUrl() != "" {
+				logger.Warnf("exporter endpoint: %s", checker.BaseUrl())
+			}
+			if compose != nil {
+				logger.Warnf("clean up with: %s", downCommand(group, compose))
+			}
+			// the down command does not know the process
+			if process != nil && process.Pid() != 0 {
+				logger.Warnf("exporter process %d is kept, stop it with: kill -- -%d", process.Pid(), process.Pid())
+			}
+		}
+
+		return checkErr
+	})
+
+	return report, reportFile, err
+}
+
+func writeReport(path string, report interface{ Yaml() ([]byte, error) }) error {
+	dumped, err := report.Yaml()
+	if err != nil {
+		return eris.Wrap(err, "failed to dump check report")
+	}
+
+	err = os.WriteFile(path, dumped, 0644)
+	if err != nil {
+		return eris.Wrap(err, "failed to write check report")
+	}
+
+	return nil
+}
+
 // checkCmd represents the check command
 var checkCmd = &cobra.Command{
 	Use:   "check",
 	Short: "Check exporter metrics",
 	Run: func(cmd *cobra.Command, args []string) {
-		container := dig.New()
-		for name, f := range map[string]interface{}{
-			"context": cmd.Context,
-			"flags":   cmd.Flags,
-			"config": func(flags *pflag.FlagSet) *viper.Viper {
-				group, _ := flags.GetString("group")
-				root := viper.GetViper()
-				config := root.Sub(group)
-				if config == nil {
-					log.Fatalf("invalid group: %s", group)
-				}
+		groups, err := checkGroups(cmd.Flags())
+		if err != nil {
+			log.Fatalf("crashed: %v", err)
+		}
 
-				config.SetDefault("report_file", "heracles-report.yml")
-				config.SetDefault("compose_file", "docker-compose.yml")
-				config.SetDefault("container", "exporter")
-				config.SetDefault("base_url", "")
-				config.SetDefault("exporter_host", "127.0.0.1")
-				config.SetDefault("exporter_port", "9601")
-				config.SetDefault("path", "/metrics")
-				config.SetDefault("wait", 3*time.Second)
-				config.SetDefault("allow_empty", false)
-				config.SetDefault("disallowed_metrics", nil)
-				config.SetDefault("metrics", nil)
-				config.SetDefault("hooks", nil)
-
-				return config
-			},
-			"docker-compose": func(config *viper.Viper, flags *pflag.FlagSet) (*core.DockerCompose, error) {
-				removeAllImages, _ := flags.GetBool("remove-all-images")
-				return core.NewDockerCompose(config.GetString("compose_file"), removeAllImages)
-			},
-			"exporter": func(config *viper.Viper, compose *core.DockerCompose) core.Exporter {
-				if config.GetString("base_url") == "" {
-					return core.NewDockerComposeExporter(
-						compose,
-						config.GetString("container"),
-						config.GetString("exporter_host"),
-						config.GetString("exporter_port"),
-						config.GetDuration("wait"),
-					)
-				} else {
-					return core.NewExternalExporter(config.GetString("base_url"))
-				}
-			},
-			"metrics-config": func(config *viper.Viper) ([]core.MetricsConfig, error) {
-				var metrics []core.MetricsConfig
-				err := config.UnmarshalKey("metrics", &metrics)
-				return metrics, eris.Wrap(err, "metrics-config unmarshaling failed")
-			},
-			"fixtures": func(compose *core.DockerCompose, config *viper.Viper) []core.Fixture {
-				fixtures := []core.Fixture{compose}
-
-				var hooks []core.ScriptHook
-				err := config.UnmarshalKey("hooks", &hooks)
-				if err != nil {
-					log.Warnf("hooks unmarshaling failed: %v", err)
-				}
+		reportFile, _ := cmd.Flags().GetString("report-file")
+
+		if len(groups) == 0 {
+			log.Fatalf("no group to check")
+		}
 
-				for _, hook := range hooks {
-					if hook.Container == "" {
-						fixtures = append(fixtures, core.NewScriptFixture(
-							hook.Name,
-							hook.Setup,
-							hook.TearDown,
-						))
-					} else {
-						fixtures = append(fixtures, core.NewContainerScriptFixture(
-							compose,
-							hook.Name,
-							hook.Container,
-							hook.Setup,
-							hook.TearDown,
-						))
+		// a matrix cell is checked as a suite, to report its cell in the matrix
+		if _, cell := core.ParseMatrixGroup(groups[0]); len(groups) == 1 && len(cell) == 0 {
+			report, groupReportFile, checkErr := checkGroup(cmd.Context(), cmd, groups[0])
+			if reportFile == "" {
+				reportFile = groupReportFile
+			}
+
+			// the report is missing if the check crashed before running
+			if report != nil && reportFile != "" {
+				err := writeReport(reportFile, report)
+				if err != nil {
+					if checkErr != nil {
+						log.Errorf("metrics check failed: %v", checkErr)
 					}
+					log.Fatalf("crashed: %v", err)
 				}
+			}
 
-				return fixtures
-			},
-			"metric-checker": func(exporter core.Exporter, fixtures []core.Fixture, config *viper.Viper, metrics []core.MetricsConfig) *core.MetricChecker {
-				return core.NewMetricChecker(
-					exporter,
-					fixtures,
-					config.GetString("path"),
-					config.GetStringSlice("disallowed_metrics"),
-					config.GetBool("allow_empty"),
-					metrics,
-					config.GetDuration("wait"),
-				)
-			},
-		} {
-			err := container.Provide(f)
-			if err != nil {
-				log.Fatalf("failed to provide %s: %v", name, err)
+			switch eris.Cause(checkErr) {
+			case nil:
+				log.Infof("metrics check passed!")
+			case core.ErrCheck:
+				log.Errorf("metrics check failed")
+				os.Exit(1)
+			case core.ErrTeardown:
+				log.Errorf("metrics check passed, but tearing down failed")
+				os.Exit(1)
+			default:
+				log.Fatalf("crashed: %v", checkErr)
 			}
+			return
 		}
 
-		err := container.Invoke(func(ctx context.Context, checker *core.MetricChecker, config *viper.Viper) error {
-			report, checkErr := checker.Check(ctx)
+		if reportFile == "" {
+			reportFile = "heracles-report.yml"
+		}
 
-			dumped, err := report.Yaml()
-			if err != nil {
-				return eris.Wrap(err, "failed to dump check report")
-			}
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		if parallel < 1 {
+			parallel = 1
+		}
 
-			err = os.WriteFile(config.GetString("report_file"), dumped, 0644)
-			if err != nil {
-				return eris.Wrap(err, "failed to write check report")
-			}
+		type groupResult struct {
+			report *core.CheckReport
+			err    error
+		}
 
-			return checkErr
-		})
+		results := make([]groupResult, len(groups))
+		semaphore := make(chan struct{}, parallel)
+		var wg sync.WaitGroup
+		for i, group := range groups {
+			wg.Add(1)
+			go func(i int, group string) {
+				defer wg.Done()
 
-		switch eris.Cause(err) {
-		case nil:
-			log.Infof("metrics check passed!")
-		case core.ErrCheck:
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+
+				ctx := log.WithPrefix(cmd.Context(), fmt.Sprintf("[%s] ", group))
+				log.FromContext(ctx).Infof("checking group %s", group)
+
+				report, _, err := checkGroup(ctx, cmd, group)
+				results[i] = groupResult{report: report, err: err}
+
+				switch eris.Cause(err) {
+				case nil:
+					log.FromContext(ctx).Infof("metrics check of group %s passed!", group)
+				case core.ErrCheck:
+					log.FromContext(ctx).Errorf("metrics check of group %s failed", group)
+				case core.ErrTeardown:
+					log.FromContext(ctx).Errorf("metrics check of group %s passed, but tearing down failed", group)
+				default:
+					log.FromContext(ctx).Errorf("metrics check of group %s crashed: %v", group, err)
+				}
+			}(i, group)
+		}
+		wg.Wait()
+
+		suite := core.NewSuiteReport()
+		for i, group := range groups {
+			suite.Add(group, results[i].report, results[i].err)
+		}
+
+		err = writeReport(reportFile, suite)
+		if err != nil {
+			log.Fatalf("crashed: %v", err)
+		}
+
+		matrixGroups := make([]string, 0, len(suite.Matrix))
+		for group := range suite.Matrix {
+			matrixGroups = append(matrixGroups, group)
+		}
+		sort.Strings(matrixGroups)
+
+		for _, group := range matrixGroups {
+			fmt.Printf("\nmatrix of group %s:\n%s", group, suite.Matrix[group].Text())
+		}
+
+		if !suite.Success {
 			log.Errorf("metrics check failed")
 			os.Exit(1)
-		default:
-			log.Fatalf("crashed: %v", err)
 		}
+
+		log.Infof("metrics check passed!")
 	},
 }
 
@@ -147,6 +261,16 @@ func init() {
 	rootCmd.AddCommand(checkCmd)
 
 	flags := checkCmd.Flags()
-	flags.StringP("group", "g", "exporter", "config group")
+	flags.StringSliceP("group", "g", []string{"exporter"}, "config groups, may be repeated")
+	flags.Bool("all", false, "check all config groups, the top-level maps declaring metrics, compose_file, process or base_url")
+	flags.IntP("parallel", "p", 1, "number of groups checked concurrently")
+	flags.Bool("ephemeral-ports", false, "let docker pick the host ports of the compose services, exporter_port is then the container port")
+	flags.String("report-file", "", "report file, defaults to the group's report_file, or heracles-report.yml for several groups or matrix cells")
 	flags.Bool("remove-all-images", false, "remove all images after check")
+	flags.Bool("build", false, "rebuild the images of the compose services declaring build, like build.force of a group")
+	flags.String("pull", "", "pull policy of the other compose services, one of always, missing, never, like build.pull_policy of a group")
+	flags.Bool("keep-on-failure", false, "keep the stack running when the check fails")
+	flags.Bool("no-teardown", false, "keep the stack running after the check")
+	flags.String("artifacts-dir", "", "directory of the service logs collected before tearing down, like logs.dir of a group")
+	flags.Bool("fail-on-teardown-error", false, "fail the check when a fixture fails to tear down, like fail_on_teardown_error of a group")
 }
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mrlyc/heracles/core"
+	"github.com/mrlyc/heracles/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rotisserie/eris"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// diffSource is one side of a diff, written as `report:PATH[#GROUP]`, `url:BASE_URL` or `service:NAME[:PORT]`.
+type diffSource struct {
+	kind  string
+	value string
+}
+
+func (s diffSource) String() string {
+	return fmt.Sprintf("%s:%s", s.kind, s.value)
+}
+
+func (s diffSource) live() bool {
+	return s.kind != "report"
+}
+
+func (s diffSource) exporter(config *viper.Viper, compose *core.DockerCompose) core.Exporter {
+	if s.kind == "url" {
+		return core.NewExternalExporter(s.value)
+	}
+
+	service, port, found := strings.Cut(s.value, ":")
+	if !found {
+		port = config.GetString("exporter_port")
+	}
+
+	return core.NewDockerComposeExporter(
+		compose,
+		service,
+		config.GetString("exporter_host"),
+		port,
+		config.GetDuration("wait"),
+	)
+}
+
+func parseDiffSource(value string) (diffSource, error) {
+	kind, rest, found := strings.Cut(value, ":")
+	if !found || rest == "" {
+		return diffSource{}, eris.Errorf("invalid diff source: %s", value)
+	}
+
+	switch kind {
+	case "report", "url", "service":
+		return diffSource{kind: kind, value: rest}, nil
+	default:
+		return diffSource{}, eris.Errorf("unknown diff source kind: %s", kind)
+	}
+}
+
+func fetchDiffSources(cmd *cobra.Command, group string, sources []diffSource) ([]map[string]*dto.MetricFamily, error) {
+	results := make([]map[string]*dto.MetricFamily, len(sources))
+
+	live := false
+	for i, source := range sources {
+		if source.live() {
+			live = true
+			continue
+		}
+
+		// the report of a group in a suite report is selected like PATH#GROUP
+		path, group, _ := strings.Cut(source.value, "#")
+		report, err := core.ReadCheckReport(path, group)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = report.Metrics
+	}
+
+	if !live {
+		return results, nil
+	}
+
+	container := newContainer(cmd.Context(), cmd, group)
+	err := container.Invoke(func(ctx context.Context, runner *core.Runner, compose *core.DockerCompose, config *viper.Viper) error {
+		return runner.RunFixtures(ctx, func(ctx context.Context) error {
+			baseUrls := make([]string, len(sources))
+			for i, source := range sources {
+				if !source.live() {
+					continue
+				} else if source.kind == "service" && compose == nil {
+					return eris.Errorf("group %s has no compose stack for source: %s", group, source)
+				}
+
+				baseUrl, err := source.exporter(config, compose).Start(ctx)
+				if err != nil {
+					return eris.Wrapf(err, "failed to start exporter: %s", source)
+				}
+				baseUrls[i] = baseUrl
+			}
+
+			wait := config.GetDuration("wait")
+			log.Infof("waiting for %s", wait)
+			err := core.Sleep(ctx, wait)
+			if err != nil {
+				return err
+			}
+
+			for i, source := range sources {
+				if !source.live() {
+					continue
+				}
+
+				metricFamilies, err := runner.FetchMetricFamilies(ctx, baseUrls[i])
+				if err != nil {
+					return eris.Wrapf(err, "failed to fetch metrics: %s", source)
+				}
+				results[i] = metricFamilies
+			}
+
+			return nil
+		})
+	})
+
+	return results, err
+}
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff LEFT RIGHT",
+	Short: "Compare the metrics of two exporter builds",
+	Long: `Compare the metric families, types, help texts, label schemas and series counts of two exporters.
+
+Each side is one of:
+  report:PATH[#GROUP]  a report written by the check command, GROUP selecting a group
+                       in the report of several groups
+  url:BASE_URL         an exporter which is already running
+  service:NAME[:PORT]  a service of the group's docker compose stack`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		sources := make([]diffSource, 0, len(args))
+		for _, arg := range args {
+			source, err := parseDiffSource(arg)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			sources = append(sources, source)
+		}
+
+		group, _ := cmd.Flags().GetString("group")
+		results, err := fetchDiffSources(cmd, group, sources)
+		if err != nil {
+			log.Fatalf("crashed: %v", err)
+		}
+
+		diff := core.DiffMetricFamilies(results[0], results[1])
+
+		format, _ := cmd.Flags().GetString("output")
+		switch format {
+		case "text":
+			fmt.Print(diff.Text())
+		case "yaml":
+			dumped, err := diff.Yaml()
+			if err != nil {
+				log.Fatalf("failed to dump diff: %v", err)
+			}
+			fmt.Print(string(dumped))
+		default:
+			log.Fatalf("unknown output format: %s", format)
+		}
+
+		exitCode, _ := cmd.Flags().GetBool("exit-code")
+		if exitCode && !diff.Empty() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	flags := diffCmd.Flags()
+	flags.StringP("group", "g", "exporter", "config group")
+	flags.Bool("remove-all-images", false, "remove all images after diff")
+	flags.Bool("build", false, "rebuild the images of the compose services declaring build, like build.force of a group")
+	flags.String("pull", "", "pull policy of the other compose services, one of always, missing, never, like build.pull_policy of a group")
+	flags.StringP("output", "o", "text", "output format, one of text, yaml")
+	flags.Bool("exit-code", false, "exit with 1 if there are differences")
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/mrlyc/heracles/core"
+	"github.com/mrlyc/heracles/log"
+	"github.com/rotisserie/eris"
+	"github.com/spf13/cobra"
+)
+
+// downCommand returns the command tearing down a stack kept by the check command.
+func downCommand(group string, compose *core.DockerCompose) string {
+	args := []string{"heracles", "down"}
+	if cfgFile != "" {
+		args = append(args, "-c", cfgFile)
+	}
+
+	args = append(args, "-g", group, "--project", compose.ProjectName)
+	if compose.EphemeralPorts {
+		args = append(args, "--ephemeral-ports")
+	}
+
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+
+	return strings.Join(args, " ")
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_./:=@%+,-]+$`)
+
+// shellQuote quotes an argument for a POSIX shell, the arguments without special characters are
+// left as is.
+func shellQuote(arg string) string {
+	if shellSafe.MatchString(arg) {
+		return arg
+	}
+
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// downCmd represents the down command
+var downCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Tear down a stack kept by the check command",
+	Long: `Tear down a stack kept by the check command with --keep-on-failure or --no-teardown,
+running the teardown commands of the group's hooks before removing the compose project.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+		group, _ := flags.GetString("group")
+
+		err := newContainer(cmd.Context(), cmd, group).Invoke(func(ctx context.Context, runner *core.Runner, fixtures []core.Fixture, compose *core.DockerCompose) error {
+			if compose == nil {
+				return eris.Errorf("group %s has no compose stack", group)
+			}
+
+			// the logs of a stack are collected by the check command which kept it
+			teardown := make([]core.Fixture, 0, len(fixtures))
+			for _, fixture := range fixtures {
+				if _, ok := fixture.(*core.ServiceLogsFixture); !ok {
+					teardown = append(teardown, fixture)
+				}
+			}
+
+			log.Infof("tearing down compose project %s", compose.ProjectName)
+			if !runner.TearDownFixtures(ctx, teardown) {
+				return eris.Errorf("failed to tear down compose project %s", compose.ProjectName)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("crashed: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(downCmd)
+
+	flags := downCmd.Flags()
+	flags.StringP("group", "g", "exporter", "config group")
+	flags.String("project", "", "compose project name printed by the check command")
+	flags.Bool("remove-all-images", false, "remove all images")
+	flags.Bool("ephemeral-ports", false, "the stack was started with ephemeral ports")
+	_ = downCmd.MarkFlagRequired("project")
+}
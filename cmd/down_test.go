@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/mrlyc/heracles/core"
+)
+
+func TestDownCommand(t *testing.T) {
+	defer func(config string) { cfgFile = config }(cfgFile)
+
+	cases := []struct {
+		name      string
+		config    string
+		group     string
+		ephemeral bool
+		want      string
+	}{
+		{
+			name:  "plain",
+			group: "exporter",
+			want:  "heracles down -g exporter --project heracles-test",
+		},
+		{
+			name:      "matrix cell",
+			config:    ".heracles.yaml",
+			group:     "postgres[POSTGRES_TAG=16;EXPORTER_TAG=v0.16.0]",
+			ephemeral: true,
+			want:      "heracles down -c .heracles.yaml -g 'postgres[POSTGRES_TAG=16;EXPORTER_TAG=v0.16.0]' --project heracles-test --ephemeral-ports",
+		},
+		{
+			name:   "config with spaces and quotes",
+			config: "/my configs/it's.yaml",
+			group:  "exporter",
+			want:   `heracles down -c '/my configs/it'\''s.yaml' -g exporter --project heracles-test`,
+		},
+		{
+			name:  "empty group",
+			group: "",
+			want:  "heracles down -g '' --project heracles-test",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfgFile = c.config
+			compose := &core.DockerCompose{ProjectName: "heracles-test", EphemeralPorts: c.ephemeral}
+			if got := downCommand(c.group, compose); got != c.want {
+				t.Errorf("got %s, want %s", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/mrlyc/heracles/core"
+	"github.com/mrlyc/heracles/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rotisserie/eris"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// generatedGroup is the group config written by the init command.
+type generatedGroup struct {
+	ComposeFile  interface{}          `yaml:"compose_file,omitempty"`
+	EnvFile      interface{}          `yaml:"env_file,omitempty"`
+	Env          []string             `yaml:"env,omitempty"`
+	Profiles     []string             `yaml:"profiles,omitempty"`
+	Container    string               `yaml:"container,omitempty"`
+	ExporterHost string               `yaml:"exporter_host,omitempty"`
+	ExporterPort string               `yaml:"exporter_port,omitempty"`
+	BaseURL      string               `yaml:"base_url,omitempty"`
+	Path         string               `yaml:"path"`
+	Metrics      []core.MetricsConfig `yaml:"metrics"`
+}
+
+// initCmd represents the init command
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Generate a group config from a live exporter",
+	Long: `Scrape a running exporter, or bring up the group's docker compose stack, and generate
+a group config listing every metric family with its type and label names.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+		group, _ := flags.GetString("group")
+		baseUrl, _ := flags.GetString("url")
+		path, _ := flags.GetString("path")
+		withSamples, _ := flags.GetBool("samples")
+		withValues, _ := flags.GetBool("values")
+		output, _ := flags.GetString("output")
+
+		generated := &generatedGroup{
+			BaseURL: baseUrl,
+			Path:    path,
+		}
+
+		callback := func(ctx context.Context, metricFamilies map[string]*dto.MetricFamily) error {
+			generated.Metrics = core.GenerateMetricsConfig(metricFamilies, withSamples, withValues)
+			return nil
+		}
+
+		var err error
+		if baseUrl != "" {
+			runner := core.NewRunner(core.NewExternalExporter(baseUrl), nil, path, 0)
+			err = runner.Run(cmd.Context(), callback)
+		} else {
+			err = newContainer(cmd.Context(), cmd, group).Invoke(func(ctx context.Context, runner *core.Runner, config *viper.Viper) error {
+				generated.ComposeFile = config.Get("compose_file")
+				generated.EnvFile = config.Get("env_file")
+				generated.Env = config.GetStringSlice("env")
+				generated.Profiles = config.GetStringSlice("profiles")
+				generated.Container = config.GetString("container")
+				generated.ExporterHost = config.GetString("exporter_host")
+				generated.ExporterPort = config.GetString("exporter_port")
+				generated.Path = config.GetString("path")
+
+				return runner.Run(ctx, callback)
+			})
+		}
+		if err != nil {
+			log.Fatalf("crashed: %v", err)
+		}
+
+		dumped, err := yaml.Marshal(map[string]*generatedGroup{group: generated})
+		if err != nil {
+			log.Fatalf("failed to dump config: %v", eris.Wrap(err, "failed to marshal config"))
+		}
+
+		if output == "" || output == "-" {
+			fmt.Print(string(dumped))
+			return
+		}
+
+		err = os.WriteFile(output, dumped, 0644)
+		if err != nil {
+			log.Fatalf("failed to write config: %v", err)
+		}
+		log.Infof("config of %d metrics written to %s", len(generated.Metrics), output)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+
+	flags := initCmd.Flags()
+	flags.StringP("group", "g", "exporter", "config group")
+	flags.Bool("remove-all-images", false, "remove all images after init")
+	flags.Bool("build", false, "rebuild the images of the compose services declaring build, like build.force of a group")
+	flags.String("pull", "", "pull policy of the other compose services, one of always, missing, never, like build.pull_policy of a group")
+	flags.String("url", "", "base url of a running exporter, the group's compose stack is used if empty")
+	flags.String("path", "/metrics", "metrics path, used with --url")
+	flags.Bool("samples", false, "generate a sample assertion for every series")
+	flags.Bool("values", false, "include the observed values in sample assertions")
+	flags.StringP("output", "o", "-", "file to write the config to")
+}
@@ -0,0 +1,441 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrlyc/heracles/core"
+	"github.com/mrlyc/heracles/log"
+	"github.com/rotisserie/eris"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/dig"
+)
+
+// hookFixtures creates the fixtures running the commands of hooks, on the machine or in a container.
+func hookFixtures(compose *core.DockerCompose, vars *core.HookVars, hooks []core.ScriptHook, flags *pflag.FlagSet) ([]core.Fixture, error) {
+	stream, _ := flags.GetBool("stream-hook-output")
+
+	fixtures := make([]core.Fixture, 0, len(hooks))
+	for _, hook := range hooks {
+		hook.Stream = hook.Stream || stream
+		if hook.Container != "" && compose == nil {
+			return nil, eris.Errorf("hook %s runs in a container without compose stack", hook.Name)
+		} else if hook.Container == "" {
+			fixtures = append(fixtures, core.NewScriptFixture(
+				hook.Name,
+				hook.SetupCommands(),
+				hook.TearDownCommands(),
+				hook.Policy(),
+				hook.Input(),
+				vars,
+				hook.Outputs,
+				hook.DependsOn,
+				hook.AlwaysTeardown,
+			))
+		} else {
+			fixtures = append(fixtures, core.NewContainerScriptFixture(
+				compose,
+				hook.Name,
+				hook.Container,
+				hook.SetupCommands(),
+				hook.TearDownCommands(),
+				hook.Policy(),
+				hook.Input(),
+				vars,
+				hook.Outputs,
+				hook.DependsOn,
+				hook.AlwaysTeardown,
+			))
+		}
+	}
+
+	return fixtures, nil
+}
+
+// onFailureFixtures creates the fixtures of the hooks run when a check fails, before tearing down.
+// Only the check command runs them, the other commands do not check anything.
+func onFailureFixtures(compose *core.DockerCompose, vars *core.HookVars, config *viper.Viper, flags *pflag.FlagSet) ([]core.Fixture, error) {
+	var hooks []core.ScriptHook
+	err := config.UnmarshalKey("on_failure", &hooks)
+	if err != nil {
+		return nil, eris.Wrap(err, "on_failure hooks unmarshaling failed")
+	}
+
+	return hookFixtures(compose, vars, hooks, flags)
+}
+
+// networkFaultFixtures creates the fixtures injecting network faults into compose services.
+func networkFaultFixtures(compose *core.DockerCompose, faults []core.NetworkFaultConfig) ([]core.Fixture, error) {
+	if len(faults) != 0 && compose == nil {
+		return nil, eris.New("network faults require a compose stack")
+	}
+
+	fixtures := make([]core.Fixture, 0, len(faults))
+	for _, fault := range faults {
+		fixture, err := core.NewNetworkFaultFixture(compose, fault)
+		if err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, fixture)
+	}
+
+	return fixtures, nil
+}
+
+// teardownPolicy returns the teardown policy selected by the --keep-on-failure and --no-teardown flags.
+func teardownPolicy(flags *pflag.FlagSet) core.TeardownPolicy {
+	if noTeardown, _ := flags.GetBool("no-teardown"); noTeardown {
+		return core.TeardownNever
+	}
+
+	if keepOnFailure, _ := flags.GetBool("keep-on-failure"); keepOnFailure {
+		return core.TeardownOnSuccess
+	}
+
+	return core.TeardownAlways
+}
+
+func teardownTimeout(flags *pflag.FlagSet) time.Duration {
+	timeout, _ := flags.GetDuration("teardown-timeout")
+	return timeout
+}
+
+// stringList returns a config value which is either a string or a list of strings.
+func stringList(config *viper.Viper, key string) []string {
+	switch value := config.Get(key).(type) {
+	case nil:
+		return nil
+	case string:
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	default:
+		return config.GetStringSlice(key)
+	}
+}
+
+// newContainer returns a dig container providing the dependencies shared by
+// the commands operating on a config group.
+func newContainer(ctx context.Context, cmd *cobra.Command, group string) *dig.Container {
+	container := dig.New()
+	for name, f := range map[string]interface{}{
+		"context": func() context.Context {
+			return ctx
+		},
+		"flags": cmd.Flags,
+		"config": func(flags *pflag.FlagSet) *viper.Viper {
+			root := viper.GetViper()
+			matrixGroup, cell := core.ParseMatrixGroup(group)
+			config := root.Sub(matrixGroup)
+			if config == nil {
+				log.Fatalf("invalid group: %s", group)
+			}
+
+			if len(cell) != 0 {
+				// the variables of a matrix cell override the env of the group
+				config.Set("env", append(config.GetStringSlice("env"), cell...))
+			}
+
+			config.SetDefault("report_file", "heracles-report.yml")
+			config.SetDefault("project_name", core.NewProjectName(group))
+			config.SetDefault("compose_file", "docker-compose.yml")
+			config.SetDefault("container", "exporter")
+			config.SetDefault("base_url", "")
+			config.SetDefault("exporter_host", "127.0.0.1")
+			config.SetDefault("exporter_port", "9601")
+			config.SetDefault("path", "/metrics")
+			config.SetDefault("wait", 3*time.Second)
+			config.SetDefault("allow_empty", false)
+			config.SetDefault("disallowed_metrics", nil)
+			config.SetDefault("metrics", nil)
+			config.SetDefault("hooks", nil)
+			config.SetDefault("on_failure", nil)
+			config.SetDefault("fail_on_teardown_error", false)
+			config.SetDefault("logs", nil)
+			config.SetDefault("process", nil)
+			config.SetDefault("build", nil)
+			config.SetDefault("env_file", nil)
+			config.SetDefault("env", nil)
+			config.SetDefault("profiles", nil)
+			config.SetDefault("steps", nil)
+			config.SetDefault("network_faults", nil)
+
+			project, _ := flags.GetString("project")
+			if project != "" {
+				config.Set("project_name", project)
+			}
+			config.SetDefault("ephemeral_ports", false)
+
+			return config
+		},
+		"docker-compose": func(config *viper.Viper, flags *pflag.FlagSet) (*core.DockerCompose, error) {
+			composeFiles := stringList(config, "compose_file")
+			if len(composeFiles) == 0 {
+				// a group with an exporter process may go without docker
+				return nil, nil
+			}
+
+			env, err := core.LoadComposeEnv(stringList(config, "env_file"), config.GetStringSlice("env"))
+			if err != nil {
+				return nil, err
+			}
+
+			var build core.ComposeBuildConfig
+			err = config.UnmarshalKey("build", &build)
+			if err != nil {
+				return nil, eris.Wrap(err, "build unmarshaling failed")
+			}
+
+			forceBuild, _ := flags.GetBool("build")
+			build.Force = build.Force || forceBuild
+
+			pullPolicy, _ := flags.GetString("pull")
+			if pullPolicy != "" {
+				build.PullPolicy = pullPolicy
+			}
+
+			removeAllImages, _ := flags.GetBool("remove-all-images")
+			ephemeralPorts, _ := flags.GetBool("ephemeral-ports")
+			compose, err := core.NewDockerCompose(
+				composeFiles,
+				config.GetString("project_name"),
+				removeAllImages,
+				ephemeralPorts || config.GetBool("ephemeral_ports"),
+				stringList(config, "profiles"),
+				build,
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(env) != 0 {
+				compose.WithEnv(env)
+			}
+
+			return compose, nil
+		},
+		"process-exporter": func(config *viper.Viper) (*core.ProcessExporter, error) {
+			if config.Get("process") == nil {
+				return nil, nil
+			}
+
+			var process core.ProcessConfig
+			err := config.UnmarshalKey("process", &process)
+			if err != nil {
+				return nil, eris.Wrap(err, "process unmarshaling failed")
+			}
+
+			if _, cell := core.ParseMatrixGroup(group); len(cell) != 0 {
+				// the variables of a matrix cell override the env of the process too
+				process.Env = append(process.Env, cell...)
+			}
+
+			return core.NewProcessExporter(
+				process,
+				config.GetString("exporter_host"),
+				config.GetString("exporter_port"),
+				config.GetString("path"),
+			)
+		},
+		"exporter": func(config *viper.Viper, compose *core.DockerCompose, process *core.ProcessExporter) (core.Exporter, error) {
+			if process != nil {
+				return process, nil
+			} else if config.GetString("base_url") != "" {
+				return core.NewExternalExporter(config.GetString("base_url")), nil
+			} else if compose == nil {
+				return nil, eris.New("compose_file is required without base_url or process")
+			}
+
+			return core.NewDockerComposeExporter(
+				compose,
+				config.GetString("container"),
+				config.GetString("exporter_host"),
+				config.GetString("exporter_port"),
+				config.GetDuration("wait"),
+			), nil
+		},
+		"metrics-config": func(config *viper.Viper) ([]core.MetricsConfig, error) {
+			var metrics []core.MetricsConfig
+			err := config.UnmarshalKey("metrics", &metrics)
+			return metrics, eris.Wrap(err, "metrics-config unmarshaling failed")
+		},
+		"hook-vars": func(compose *core.DockerCompose, exporter core.Exporter) (*core.HookVars, error) {
+			vars := core.NewHookVars(group, compose, exporter)
+
+			// the variables of a matrix cell are readable like hook outputs
+			_, cell := core.ParseMatrixGroup(group)
+			env, err := core.ParseEnv(cell)
+			if err != nil {
+				return nil, err
+			}
+
+			for name, value := range env {
+				vars.Set(name, value)
+			}
+
+			return vars, nil
+		},
+		"logs-config": func(config *viper.Viper, flags *pflag.FlagSet) (core.LogsConfig, error) {
+			var logs core.LogsConfig
+			err := config.UnmarshalKey("logs", &logs)
+			if err != nil {
+				return logs, eris.Wrap(err, "logs unmarshaling failed")
+			}
+
+			artifactsDir, _ := flags.GetString("artifacts-dir")
+			if artifactsDir != "" {
+				logs.Dir = artifactsDir
+			}
+
+			return logs, nil
+		},
+		"fixtures": func(
+			compose *core.DockerCompose, process *core.ProcessExporter, vars *core.HookVars,
+			config *viper.Viper, flags *pflag.FlagSet, logs core.LogsConfig,
+		) ([]core.Fixture, error) {
+			var hooks []core.ScriptHook
+			err := config.UnmarshalKey("hooks", &hooks)
+			if err != nil {
+				log.Warnf("hooks unmarshaling failed: %v", err)
+			}
+
+			var faults []core.NetworkFaultConfig
+			err = config.UnmarshalKey("network_faults", &faults)
+			if err != nil {
+				return nil, eris.Wrap(err, "network faults unmarshaling failed")
+			}
+
+			faultFixtures, err := networkFaultFixtures(compose, faults)
+			if err != nil {
+				return nil, err
+			}
+
+			var fixtures []core.Fixture
+			if compose != nil {
+				fixtures = append(fixtures, compose)
+				if logs.Dir != "" {
+					// torn down right before the compose stack
+					fixtures = append(fixtures, core.NewServiceLogsFixture(compose, logs.Dir, logs.Services))
+				}
+			}
+
+			if process != nil {
+				// the exporter process may need the compose services, the hooks may need the exporter
+				fixtures = append(fixtures, process)
+			}
+
+			scriptFixtures, err := hookFixtures(compose, vars, hooks, flags)
+			if err != nil {
+				return nil, err
+			}
+
+			fixtures = append(fixtures, scriptFixtures...)
+			return append(fixtures, faultFixtures...), nil
+		},
+		"steps": func(compose *core.DockerCompose, vars *core.HookVars, config *viper.Viper, flags *pflag.FlagSet) ([]*core.Step, error) {
+			var stepConfigs []core.StepConfig
+			err := config.UnmarshalKey("steps", &stepConfigs)
+			if err != nil {
+				return nil, eris.Wrap(err, "steps unmarshaling failed")
+			}
+
+			steps := make([]*core.Step, 0, len(stepConfigs))
+			for _, stepConfig := range stepConfigs {
+				fixtures := make([]core.Fixture, 0, len(stepConfig.Actions)+len(stepConfig.Hooks))
+				if len(stepConfig.Actions) != 0 && compose == nil {
+					return nil, eris.Errorf("actions of step %s require a compose stack", stepConfig.Name)
+				}
+
+				for _, action := range stepConfig.Actions {
+					fixture, err := core.NewServiceActionFixture(compose, action)
+					if err != nil {
+						return nil, eris.Wrapf(err, "invalid step: %s", stepConfig.Name)
+					}
+					fixtures = append(fixtures, fixture)
+				}
+
+				faultFixtures, err := networkFaultFixtures(compose, stepConfig.NetworkFaults)
+				if err != nil {
+					return nil, eris.Wrapf(err, "invalid step: %s", stepConfig.Name)
+				}
+				fixtures = append(fixtures, faultFixtures...)
+
+				scriptFixtures, err := hookFixtures(compose, vars, stepConfig.Hooks, flags)
+				if err != nil {
+					return nil, eris.Wrapf(err, "invalid step: %s", stepConfig.Name)
+				}
+
+				fixtures = append(fixtures, scriptFixtures...)
+				steps = append(steps, core.NewStep(stepConfig, fixtures))
+			}
+
+			return steps, nil
+		},
+		"runner": func(exporter core.Exporter, fixtures []core.Fixture, config *viper.Viper, flags *pflag.FlagSet) *core.Runner {
+			runner := core.NewRunner(
+				exporter,
+				fixtures,
+				config.GetString("path"),
+				config.GetDuration("wait"),
+			)
+			runner.SetTeardownPolicy(teardownPolicy(flags))
+			runner.SetTeardownTimeout(teardownTimeout(flags))
+			return runner
+		},
+		"metric-checker": func(
+			exporter core.Exporter, fixtures []core.Fixture, config *viper.Viper, flags *pflag.FlagSet,
+			metrics []core.MetricsConfig, steps []*core.Step, vars *core.HookVars, compose *core.DockerCompose,
+			process *core.ProcessExporter, logs core.LogsConfig,
+		) (*core.MetricChecker, error) {
+			onFailure, err := onFailureFixtures(compose, vars, config, flags)
+			if err != nil {
+				return nil, err
+			}
+
+			checker := core.NewMetricChecker(
+				exporter,
+				fixtures,
+				config.GetString("path"),
+				config.GetStringSlice("disallowed_metrics"),
+				config.GetBool("allow_empty"),
+				metrics,
+				config.GetDuration("wait"),
+				steps,
+			)
+			checker.SetTeardownPolicy(teardownPolicy(flags))
+			checker.SetTeardownTimeout(teardownTimeout(flags))
+			checker.SetHookVars(vars)
+			checker.SetOnFailureFixtures(onFailure)
+
+			failOnTeardownError, _ := flags.GetBool("fail-on-teardown-error")
+			checker.SetFailOnTeardownError(failOnTeardownError || config.GetBool("fail_on_teardown_error"))
+
+			logsCheckers, err := core.BuildLogsCheckers(logs)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case len(logsCheckers) == 0:
+			case process != nil:
+				checker.SetLogsCheckers(process, process.GetName(), logsCheckers)
+			case config.GetString("base_url") != "":
+				return nil, eris.New("logs of an external exporter can not be checked")
+			default:
+				checker.SetLogsCheckers(compose, config.GetString("container"), logsCheckers)
+			}
+
+			return checker, nil
+		},
+	} {
+		err := container.Provide(f)
+		if err != nil {
+			log.Fatalf("failed to provide %s: %v", name, err)
+		}
+	}
+
+	return container
+}
@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/mrlyc/heracles/log"
 	"github.com/spf13/cobra"
@@ -18,12 +22,34 @@ var rootCmd = &cobra.Command{}
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
+// signalContext 返回一个在收到 SIGINT 或 SIGTERM 时取消的 context，再次收到信号时直接退出
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Warnf("received %s, tearing down, send it again to exit immediately", sig)
+		cancel()
+
+		sig = <-signals
+		log.Errorf("received %s again, exiting", sig)
+		os.Exit(130)
+	}()
+
+	return ctx, cancel
+}
+
 // initConfig 读取配置文件
 func initConfig() {
 	if cfgFile != "" {
@@ -60,6 +86,8 @@ func init() {
 	flags := rootCmd.PersistentFlags()
 	flags.StringVarP(&cfgFile, "config", "c", ".heracles.yaml", "config file (default is .heracles.yaml)")
 	flags.StringP("log-level", "l", "info", "log level")
+	flags.Bool("stream-hook-output", false, "log the output of the hook commands as they run, it is always recorded in the report")
+	flags.Duration("teardown-timeout", 5*time.Minute, "time limit of tearing down, which also runs after an interrupt")
 
 	_ = viper.BindPFlag("log_level", flags.Lookup("log-level"))
 }
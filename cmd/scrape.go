@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mrlyc/heracles/core"
+	"github.com/mrlyc/heracles/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/rotisserie/eris"
+	"github.com/spf13/cobra"
+)
+
+func sortedMetricFamilies(metricFamilies map[string]*dto.MetricFamily) []*dto.MetricFamily {
+	sorted := make([]*dto.MetricFamily, 0, len(metricFamilies))
+	for _, metricFamily := range metricFamilies {
+		sorted = append(sorted, metricFamily)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].GetName() < sorted[j].GetName()
+	})
+
+	return sorted
+}
+
+func formatLabels(metric *dto.Metric) string {
+	labels := make([]string, 0, len(metric.GetLabel()))
+	for _, label := range metric.GetLabel() {
+		labels = append(labels, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func formatSampleValue(metric *dto.Metric) string {
+	switch {
+	case metric.GetGauge() != nil:
+		return strconv.FormatFloat(metric.GetGauge().GetValue(), 'g', -1, 64)
+	case metric.GetCounter() != nil:
+		return strconv.FormatFloat(metric.GetCounter().GetValue(), 'g', -1, 64)
+	case metric.GetUntyped() != nil:
+		return strconv.FormatFloat(metric.GetUntyped().GetValue(), 'g', -1, 64)
+	case metric.GetSummary() != nil:
+		summary := metric.GetSummary()
+		return fmt.Sprintf("count=%d sum=%g", summary.GetSampleCount(), summary.GetSampleSum())
+	case metric.GetHistogram() != nil:
+		histogram := metric.GetHistogram()
+		return fmt.Sprintf("count=%d sum=%g", histogram.GetSampleCount(), histogram.GetSampleSum())
+	}
+	return ""
+}
+
+func printMetricFamilies(w io.Writer, format string, metricFamilies map[string]*dto.MetricFamily) error {
+	sorted := sortedMetricFamilies(metricFamilies)
+
+	switch format {
+	case "text":
+		for _, metricFamily := range sorted {
+			_, err := expfmt.MetricFamilyToText(w, metricFamily)
+			if err != nil {
+				return eris.Wrap(err, "failed to write metrics")
+			}
+		}
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(sorted)
+		if err != nil {
+			return eris.Wrap(err, "failed to write metrics")
+		}
+	case "table":
+		writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "NAME\tTYPE\tLABELS\tVALUE")
+		for _, metricFamily := range sorted {
+			for _, metric := range metricFamily.GetMetric() {
+				_, _ = fmt.Fprintf(
+					writer, "%s\t%s\t%s\t%s\n",
+					metricFamily.GetName(),
+					strings.ToLower(metricFamily.GetType().String()),
+					formatLabels(metric),
+					formatSampleValue(metric),
+				)
+			}
+		}
+		return writer.Flush()
+	default:
+		return eris.Errorf("unknown output format: %s", format)
+	}
+
+	return nil
+}
+
+// scrapeCmd represents the scrape command
+var scrapeCmd = &cobra.Command{
+	Use:   "scrape",
+	Short: "Fetch and print exporter metrics",
+	Long: `Fetch metrics from a running exporter, or from the group's docker compose stack,
+and print the metric families matching the name regexes and label matchers.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+		group, _ := flags.GetString("group")
+		baseUrl, _ := flags.GetString("url")
+		path, _ := flags.GetString("path")
+		names, _ := flags.GetStringArray("name")
+		labels, _ := flags.GetStringArray("label")
+		format, _ := flags.GetString("output")
+
+		filter, err := core.NewMetricFamiliesFilter(names, labels)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		callback := func(ctx context.Context, metricFamilies map[string]*dto.MetricFamily) error {
+			return printMetricFamilies(os.Stdout, format, filter.Filter(metricFamilies))
+		}
+
+		if baseUrl != "" {
+			runner := core.NewRunner(core.NewExternalExporter(baseUrl), nil, path, 0)
+			err = runner.Run(cmd.Context(), callback)
+		} else {
+			err = newContainer(cmd.Context(), cmd, group).Invoke(func(ctx context.Context, runner *core.Runner) error {
+				return runner.Run(ctx, callback)
+			})
+		}
+		if err != nil {
+			log.Fatalf("crashed: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scrapeCmd)
+
+	flags := scrapeCmd.Flags()
+	flags.StringP("group", "g", "exporter", "config group")
+	flags.Bool("remove-all-images", false, "remove all images after scrape")
+	flags.Bool("build", false, "rebuild the images of the compose services declaring build, like build.force of a group")
+	flags.String("pull", "", "pull policy of the other compose services, one of always, missing, never, like build.pull_policy of a group")
+	flags.String("url", "", "base url of a running exporter, the group's compose stack is used if empty")
+	flags.String("path", "/metrics", "metrics path, used with --url")
+	flags.StringArrayP("name", "n", nil, "metric name regex, may be repeated")
+	flags.StringArrayP("label", "m", nil, "label matcher like name=value, name!=value, name=~regex or name!~regex, may be repeated")
+	flags.StringP("output", "o", "text", "output format, one of text, json, table")
+}
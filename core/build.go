@@ -0,0 +1,146 @@
+package core
+
+import (
+	"os"
+	"sort"
+
+	"github.com/rotisserie/eris"
+	"gopkg.in/yaml.v3"
+)
+
+// ServiceBuildConfig overrides the `build:` of a compose service. The services and the build args
+// are listed rather than mapped, as the keys of config maps are lowercased.
+type ServiceBuildConfig struct {
+	Name string `mapstructure:"name"`
+	// Args are like KEY=VALUE.
+	Args   []string `mapstructure:"args"`
+	Target string   `mapstructure:"target"`
+}
+
+// ComposeBuildConfig controls how the images of the compose services are built and pulled.
+type ComposeBuildConfig struct {
+	// Force rebuilds the services declaring `build:` even if their images exist.
+	Force bool `mapstructure:"force"`
+	// PullPolicy is the pull_policy of the services which are not built: always, missing or never.
+	PullPolicy string               `mapstructure:"pull_policy"`
+	Services   []ServiceBuildConfig `mapstructure:"services"`
+}
+
+// Empty returns true if the compose file is used as it is.
+func (c ComposeBuildConfig) Empty() bool {
+	return !c.Force && c.PullPolicy == "" && len(c.Services) == 0
+}
+
+type buildOverrideBuild struct {
+	Args   map[string]string `yaml:"args,omitempty"`
+	Target string            `yaml:"target,omitempty"`
+}
+
+type buildOverrideService struct {
+	Build      *buildOverrideBuild `yaml:"build,omitempty"`
+	PullPolicy string              `yaml:"pull_policy,omitempty"`
+}
+
+type buildOverride struct {
+	Services map[string]buildOverrideService `yaml:"services"`
+}
+
+// builtServices returns the services of compose files by whether one of the files declares `build:`.
+func builtServices(composeFilePaths []string) (map[string]bool, error) {
+	built := make(map[string]bool)
+	for _, composeFilePath := range composeFilePaths {
+		data, err := os.ReadFile(composeFilePath)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to read compose file: %s", composeFilePath)
+		}
+
+		var document yaml.Node
+		err = yaml.Unmarshal(data, &document)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to parse compose file: %s", composeFilePath)
+		}
+
+		var root *yaml.Node
+		if len(document.Content) != 0 {
+			root = document.Content[0]
+		}
+
+		services := mappingValue(root, "services")
+		if services != nil && services.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(services.Content); i += 2 {
+				name := services.Content[i].Value
+				built[name] = built[name] || mappingValue(services.Content[i+1], "build") != nil
+			}
+		}
+	}
+
+	return built, nil
+}
+
+// buildComposeFile returns a compose file overriding the build args and targets and the pull policies
+// of the services of the given files. Compose merges it into them, the services forced to rebuild get
+// the `build` pull policy. It returns nothing if nothing is overridden.
+func buildComposeFile(composeFilePaths []string, config ComposeBuildConfig) ([]byte, error) {
+	switch config.PullPolicy {
+	case "", "always", "missing", "never":
+	default:
+		return nil, eris.Errorf("invalid pull policy: %s", config.PullPolicy)
+	}
+
+	built, err := builtServices(composeFilePaths)
+	if err != nil {
+		return nil, err
+	}
+
+	builds := make(map[string]*buildOverrideBuild, len(config.Services))
+	for _, service := range config.Services {
+		switch _, ok := built[service.Name]; {
+		case service.Name == "":
+			return nil, eris.New("name of service to build is required")
+		case !ok:
+			return nil, eris.Errorf("unknown service to build: %s", service.Name)
+		case !built[service.Name]:
+			return nil, eris.Errorf("service %s has no build in compose files: %v", service.Name, composeFilePaths)
+		case builds[service.Name] != nil:
+			return nil, eris.Errorf("duplicated service to build: %s", service.Name)
+		}
+
+		args, err := ParseEnv(service.Args)
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid build args of service %s", service.Name)
+		}
+		builds[service.Name] = &buildOverrideBuild{Args: args, Target: service.Target}
+	}
+
+	names := make([]string, 0, len(built))
+	for name := range built {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	override := buildOverride{Services: make(map[string]buildOverrideService)}
+	for _, name := range names {
+		var service buildOverrideService
+		if built[name] && config.Force {
+			service.PullPolicy = "build"
+		} else if !built[name] {
+			service.PullPolicy = config.PullPolicy
+		}
+
+		service.Build = builds[name]
+		if service.Build != nil || service.PullPolicy != "" {
+			override.Services[name] = service
+		}
+	}
+
+	if len(override.Services) == 0 {
+		return nil, nil
+	}
+
+	data, err := yaml.Marshal(&override)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to dump compose file")
+	}
+
+	return data, nil
+}
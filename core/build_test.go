@@ -0,0 +1,106 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestBuildComposeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docker-compose.yml")
+	err := os.WriteFile(path, []byte(`services:
+  Exporter:
+    build: .
+  postgres:
+    image: postgres
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		config  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "args keep case",
+			config: `build:
+  services:
+    - name: Exporter
+      args:
+        - VERSION=dev
+        - GO_FLAGS=-a=b
+      target: test
+`,
+			want: `services:
+    Exporter:
+        build:
+            args:
+                GO_FLAGS: -a=b
+                VERSION: dev
+            target: test
+`,
+		},
+		{
+			name: "pull policy",
+			config: `build:
+  pull_policy: never
+`,
+			want: `services:
+    postgres:
+        pull_policy: never
+`,
+		},
+		{
+			name:    "unknown service",
+			config:  "build:\n  services:\n    - name: exporter\n",
+			wantErr: true,
+		},
+		{
+			name:    "service without build",
+			config:  "build:\n  services:\n    - name: postgres\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicated service",
+			config:  "build:\n  services:\n    - name: Exporter\n    - name: Exporter\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid args",
+			config:  "build:\n  services:\n    - name: Exporter\n      args: [VERSION]\n",
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config := viper.New()
+			config.SetConfigType("yaml")
+			err := config.ReadConfig(bytes.NewBufferString(c.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var build ComposeBuildConfig
+			err = config.UnmarshalKey("build", &build)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := buildComposeFile([]string{path}, build)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("got error %v, want error %v", err, c.wantErr)
+			}
+
+			if got := string(data); got != c.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, c.want)
+			}
+		})
+	}
+}
@@ -173,6 +173,22 @@ func (c *MetricLabelDisallowChecker) Check(metricFamilies map[string]*dto.Metric
 	return true, okMessage
 }
 
+// metricValue returns the value of a sample, summaries and histograms are represented by their sum.
+func metricValue(metric *dto.Metric) (float64, bool) {
+	if metric.GetGauge() != nil {
+		return metric.GetGauge().GetValue(), true
+	} else if metric.GetCounter() != nil {
+		return metric.GetCounter().GetValue(), true
+	} else if metric.GetSummary() != nil {
+		return metric.GetSummary().GetSampleSum(), true
+	} else if metric.GetHistogram() != nil {
+		return metric.GetHistogram().GetSampleSum(), true
+	} else if metric.GetUntyped() != nil {
+		return metric.GetUntyped().GetValue(), true
+	}
+	return 0, false
+}
+
 type metricFilter struct {
 	labels map[string]string
 }
@@ -251,18 +267,8 @@ func (m *MetricSampleValueChecker) Check(metricFamilies map[string]*dto.MetricFa
 				continue
 			}
 
-			var value float64
-			if metric.GetGauge() != nil {
-				value = metric.GetGauge().GetValue()
-			} else if metric.GetCounter() != nil {
-				value = metric.GetCounter().GetValue()
-			} else if metric.GetSummary() != nil {
-				value = metric.GetSummary().GetSampleSum()
-			} else if metric.GetHistogram() != nil {
-				value = metric.GetHistogram().GetSampleSum()
-			} else if metric.GetUntyped() != nil {
-				value = metric.GetUntyped().GetValue()
-			} else {
+			value, ok := metricValue(metric)
+			if !ok {
 				return false, fmt.Sprintf("expected value %f, but got nil in metric %s", value, m.Name)
 			}
 
@@ -12,6 +12,31 @@ type Fixture interface {
 	TearDown(ctx context.Context) error
 }
 
+// ReportingFixture is a fixture recording the commands it runs.
+type ReportingFixture interface {
+	Fixture
+	Report() *FixtureReport
+}
+
+// DependentFixture is a named fixture set up after the fixtures it depends on.
+type DependentFixture interface {
+	Fixture
+	GetName() string
+	DependsOn() []string
+}
+
+// AlwaysTearDownFixture is a fixture torn down even if its setup failed, which may have left state.
+type AlwaysTearDownFixture interface {
+	Fixture
+	AlwaysTearDown() bool
+}
+
+// ArtifactsFixture is a fixture writing files which the report refers to.
+type ArtifactsFixture interface {
+	Fixture
+	Artifacts() map[string]string
+}
+
 type Exporter interface {
 	Start(ctx context.Context) (string, error)
 }
@@ -21,6 +46,18 @@ type MetricFamiliesChecker interface {
 	Check(metricFamily map[string]*dto.MetricFamily) (bool, string)
 }
 
+// LogsChecker checks the logs of a service.
+type LogsChecker interface {
+	String() string
+	Check(logs string) (bool, string)
+}
+
+// LogSource returns the logs of a service.
+type LogSource interface {
+	ServiceLogs(ctx context.Context, service string) (string, error)
+}
+
 type HTTPClient interface {
 	Get(string) (*http.Response, error)
+	Do(*http.Request) (*http.Response, error)
 }
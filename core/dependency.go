@@ -0,0 +1,228 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/mrlyc/heracles/log"
+	"github.com/rotisserie/eris"
+)
+
+// FixtureStatus is the outcome of setting up or tearing down a fixture.
+type FixtureStatus struct {
+	Fixture string `yaml:"fixture"`
+	Status  string `yaml:"status"`
+	Error   string `yaml:"error,omitempty"`
+}
+
+const (
+	FixtureStatusOk      = "ok"
+	FixtureStatusFailed  = "failed"
+	FixtureStatusSkipped = "skipped"
+)
+
+// fixtureName returns the name of a fixture in logs and reports.
+func fixtureName(fixture Fixture) string {
+	if named, ok := fixture.(DependentFixture); ok && named.GetName() != "" {
+		return named.GetName()
+	}
+
+	if stringer, ok := fixture.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+
+	return fmt.Sprintf("%T", fixture)
+}
+
+// fixtureDependencies returns the indexes of the fixtures which each fixture waits for.
+//
+// Without any depends_on, every fixture waits for the one before it, as they always did. Otherwise
+// a dependent fixture waits for the fixtures it depends on and for the last other fixture before
+// it, like the compose stack, while other fixtures wait for all the fixtures before them. So a
+// fixture placed before another fixture, like a network fault or an action, cannot depend on a
+// fixture placed after it.
+func fixtureDependencies(fixtures []Fixture) ([][]int, error) {
+	graph := false
+	names := make(map[string]int, len(fixtures))
+	for i, fixture := range fixtures {
+		dependent, ok := fixture.(DependentFixture)
+		if !ok {
+			continue
+		}
+
+		if len(dependent.DependsOn()) != 0 {
+			graph = true
+		}
+
+		name := dependent.GetName()
+		if _, ok := names[name]; ok && name != "" {
+			names[name] = -1
+		} else if name != "" {
+			names[name] = i
+		}
+	}
+
+	dependencies := make([][]int, len(fixtures))
+	barrier := -1
+	for i, fixture := range fixtures {
+		dependent, ok := fixture.(DependentFixture)
+		switch {
+		case !graph:
+			if i > 0 {
+				dependencies[i] = []int{i - 1}
+			}
+		case !ok:
+			for j := 0; j < i; j++ {
+				dependencies[i] = append(dependencies[i], j)
+			}
+			barrier = i
+		default:
+			if barrier >= 0 {
+				dependencies[i] = append(dependencies[i], barrier)
+			}
+
+			for _, name := range dependent.DependsOn() {
+				j, ok := names[name]
+				switch {
+				case !ok:
+					return nil, eris.Errorf("fixture %s depends on an unknown fixture: %s", dependent.GetName(), name)
+				case j < 0:
+					return nil, eris.Errorf("fixture %s depends on an ambiguous fixture: %s", dependent.GetName(), name)
+				case j == i:
+					return nil, eris.Errorf("fixture %s depends on itself", name)
+				}
+				dependencies[i] = append(dependencies[i], j)
+			}
+		}
+	}
+
+	// Kahn's algorithm, the fixtures left unordered are in a cycle
+	waiting := make([]int, len(fixtures))
+	dependents := make([][]int, len(fixtures))
+	for i, items := range dependencies {
+		waiting[i] = len(items)
+		for _, j := range items {
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	var ready []int
+	for i, count := range waiting {
+		if count == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	ordered := 0
+	for len(ready) > 0 {
+		i := ready[0]
+		ready = ready[1:]
+		ordered++
+
+		for _, j := range dependents[i] {
+			waiting[j]--
+			if waiting[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+
+	if ordered != len(fixtures) {
+		var cycle, barriers []string
+		for i, count := range waiting {
+			if count == 0 {
+				continue
+			}
+
+			cycle = append(cycle, fixtureName(fixtures[i]))
+			if _, ok := fixtures[i].(DependentFixture); !ok {
+				barriers = append(barriers, fixtureName(fixtures[i]))
+			}
+		}
+
+		if len(barriers) != 0 {
+			return nil, eris.Errorf(
+				"fixtures depend on each other: %v, the fixtures without depends_on like %v wait for all the fixtures before them, "+
+					"which cannot depend on the fixtures after them", cycle, barriers,
+			)
+		}
+		return nil, eris.Errorf("fixtures depend on each other: %v", cycle)
+	}
+
+	return dependencies, nil
+}
+
+// setupFixtureGraph sets up every fixture once the fixtures it waits for are set up, concurrently.
+// A fixture whose dependency failed is skipped. The fixtures set up are returned in the order they
+// were, so tearing them down in reverse never tears a fixture down before its dependents, along
+// with the failed fixtures which are always torn down.
+func setupFixtureGraph(ctx context.Context, fixtures []Fixture) ([]Fixture, []*FixtureStatus, error) {
+	dependencies, err := fixtureDependencies(fixtures)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		lock     sync.Mutex
+		wg       sync.WaitGroup
+		setups   = make([]Fixture, 0, len(fixtures))
+		statuses = make([]*FixtureStatus, len(fixtures))
+		errs     = make([]error, len(fixtures))
+		done     = make([]chan struct{}, len(fixtures))
+	)
+
+	for i := range fixtures {
+		done[i] = make(chan struct{})
+	}
+
+	for i, fixture := range fixtures {
+		wg.Add(1)
+		go func(i int, fixture Fixture) {
+			defer wg.Done()
+			defer close(done[i])
+
+			status := &FixtureStatus{Fixture: fixtureName(fixture)}
+			statuses[i] = status
+
+			for _, j := range dependencies[i] {
+				<-done[j]
+				if statuses[j].Status != FixtureStatusOk {
+					status.Status = FixtureStatusSkipped
+					status.Error = fmt.Sprintf("dependency %s %s", statuses[j].Fixture, statuses[j].Status)
+					log.FromContext(ctx).Warnf("skipping fixture %s, %s", status.Fixture, status.Error)
+					return
+				}
+			}
+
+			log.FromContext(ctx).Debugf("setting up fixture: %s", fixture)
+			err := fixture.Setup(ctx)
+			if err != nil {
+				status.Status = FixtureStatusFailed
+				status.Error = err.Error()
+				errs[i] = eris.Wrapf(err, "failed to setup fixture: %s", status.Fixture)
+
+				if always, ok := fixture.(AlwaysTearDownFixture); ok && always.AlwaysTearDown() {
+					lock.Lock()
+					setups = append(setups, fixture)
+					lock.Unlock()
+				}
+				return
+			}
+
+			status.Status = FixtureStatusOk
+			lock.Lock()
+			setups = append(setups, fixture)
+			lock.Unlock()
+		}(i, fixture)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return setups, statuses, err
+		}
+	}
+
+	return setups, statuses, nil
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"gopkg.in/yaml.v3"
+)
+
+type ValueChange struct {
+	Left  string `yaml:"left"`
+	Right string `yaml:"right"`
+}
+
+type SeriesChange struct {
+	Left  int `yaml:"left"`
+	Right int `yaml:"right"`
+}
+
+type MetricFamilyDiff struct {
+	Name          string        `yaml:"name"`
+	Type          *ValueChange  `yaml:"type,omitempty"`
+	Help          *ValueChange  `yaml:"help,omitempty"`
+	AddedLabels   []string      `yaml:"added_labels,omitempty"`
+	RemovedLabels []string      `yaml:"removed_labels,omitempty"`
+	Series        *SeriesChange `yaml:"series,omitempty"`
+}
+
+func (d *MetricFamilyDiff) empty() bool {
+	return d.Type == nil && d.Help == nil && len(d.AddedLabels) == 0 && len(d.RemovedLabels) == 0 && d.Series == nil
+}
+
+// MetricFamiliesDiff describes how the right side metric families differ from the left side.
+type MetricFamiliesDiff struct {
+	Added   []string            `yaml:"added,omitempty"`
+	Removed []string            `yaml:"removed,omitempty"`
+	Changed []*MetricFamilyDiff `yaml:"changed,omitempty"`
+}
+
+func (d *MetricFamiliesDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func (d *MetricFamiliesDiff) Yaml() ([]byte, error) {
+	return yaml.Marshal(d)
+}
+
+// Text renders the diff in a line oriented, human readable form.
+func (d *MetricFamiliesDiff) Text() string {
+	var builder strings.Builder
+
+	for _, name := range d.Removed {
+		_, _ = fmt.Fprintf(&builder, "- %s\n", name)
+	}
+
+	for _, name := range d.Added {
+		_, _ = fmt.Fprintf(&builder, "+ %s\n", name)
+	}
+
+	for _, changed := range d.Changed {
+		_, _ = fmt.Fprintf(&builder, "~ %s\n", changed.Name)
+		if changed.Type != nil {
+			_, _ = fmt.Fprintf(&builder, "    type: %s -> %s\n", changed.Type.Left, changed.Type.Right)
+		}
+		if changed.Help != nil {
+			_, _ = fmt.Fprintf(&builder, "    help: %q -> %q\n", changed.Help.Left, changed.Help.Right)
+		}
+		for _, label := range changed.RemovedLabels {
+			_, _ = fmt.Fprintf(&builder, "    - label %s\n", label)
+		}
+		for _, label := range changed.AddedLabels {
+			_, _ = fmt.Fprintf(&builder, "    + label %s\n", label)
+		}
+		if changed.Series != nil {
+			_, _ = fmt.Fprintf(&builder, "    series: %d -> %d\n", changed.Series.Left, changed.Series.Right)
+		}
+	}
+
+	return builder.String()
+}
+
+// metricFamilyLabelNames returns the sorted union of label names used by the series of a metric family.
+func metricFamilyLabelNames(metricFamily *dto.MetricFamily) []string {
+	names := make(map[string]bool)
+	for _, metric := range metricFamily.GetMetric() {
+		for _, label := range metric.GetLabel() {
+			names[label.GetName()] = true
+		}
+	}
+
+	labels := make([]string, 0, len(names))
+	for name := range names {
+		labels = append(labels, name)
+	}
+	sort.Strings(labels)
+
+	return labels
+}
+
+// subtractStrings returns the items of a which are not in b, a and b must be sorted.
+func subtractStrings(a, b []string) []string {
+	var result []string
+	for _, item := range a {
+		index := sort.SearchStrings(b, item)
+		if index < len(b) && b[index] == item {
+			continue
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+func diffMetricFamily(left, right *dto.MetricFamily) *MetricFamilyDiff {
+	diff := &MetricFamilyDiff{
+		Name: left.GetName(),
+	}
+
+	if left.GetType() != right.GetType() {
+		diff.Type = &ValueChange{Left: left.GetType().String(), Right: right.GetType().String()}
+	}
+
+	if left.GetHelp() != right.GetHelp() {
+		diff.Help = &ValueChange{Left: left.GetHelp(), Right: right.GetHelp()}
+	}
+
+	leftLabels := metricFamilyLabelNames(left)
+	rightLabels := metricFamilyLabelNames(right)
+	diff.AddedLabels = subtractStrings(rightLabels, leftLabels)
+	diff.RemovedLabels = subtractStrings(leftLabels, rightLabels)
+
+	if len(left.GetMetric()) != len(right.GetMetric()) {
+		diff.Series = &SeriesChange{Left: len(left.GetMetric()), Right: len(right.GetMetric())}
+	}
+
+	return diff
+}
+
+// DiffMetricFamilies compares the families, types, help texts, label schemas and series counts of two scrapes.
+func DiffMetricFamilies(left, right map[string]*dto.MetricFamily) *MetricFamiliesDiff {
+	diff := &MetricFamiliesDiff{}
+
+	for name, leftFamily := range left {
+		rightFamily, ok := right[name]
+		if !ok {
+			diff.Removed = append(diff.Removed, name)
+			continue
+		}
+
+		changed := diffMetricFamily(leftFamily, rightFamily)
+		if !changed.empty() {
+			diff.Changed = append(diff.Changed, changed)
+		}
+	}
+
+	for name := range right {
+		if _, ok := left[name]; !ok {
+			diff.Added = append(diff.Added, name)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Name < diff.Changed[j].Name
+	})
+
+	return diff
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// parseMetricFamilies parses metric families in the text exposition format.
+func parseMetricFamilies(t *testing.T, text string) map[string]*dto.MetricFamily {
+	t.Helper()
+
+	var parser expfmt.TextParser
+	metricFamilies, err := parser.TextToMetricFamilies(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("failed to parse metrics: %v", err)
+	}
+
+	return metricFamilies
+}
+
+func TestDiffMetricFamilies(t *testing.T) {
+	cases := []struct {
+		name  string
+		left  string
+		right string
+		want  *MetricFamiliesDiff
+	}{
+		{
+			name:  "same",
+			left:  "# TYPE up gauge\nup 1\n",
+			right: "# TYPE up gauge\nup 0\n",
+			want:  &MetricFamiliesDiff{},
+		},
+		{
+			name:  "added and removed",
+			left:  "# TYPE a gauge\na 1\n# TYPE b gauge\nb 1\n",
+			right: "# TYPE b gauge\nb 1\n# TYPE d gauge\nd 1\n# TYPE c gauge\nc 1\n",
+			want: &MetricFamiliesDiff{
+				Added:   []string{"c", "d"},
+				Removed: []string{"a"},
+			},
+		},
+		{
+			name:  "type and help",
+			left:  "# HELP a old\n# TYPE a gauge\na 1\n",
+			right: "# HELP a new\n# TYPE a counter\na 1\n",
+			want: &MetricFamiliesDiff{
+				Changed: []*MetricFamilyDiff{{
+					Name: "a",
+					Type: &ValueChange{Left: "GAUGE", Right: "COUNTER"},
+					Help: &ValueChange{Left: "old", Right: "new"},
+				}},
+			},
+		},
+		{
+			name:  "labels and series",
+			left:  "# TYPE a gauge\na{x=\"1\",y=\"1\"} 1\n",
+			right: "# TYPE a gauge\na{x=\"1\",z=\"1\"} 1\na{x=\"2\",z=\"1\"} 1\n",
+			want: &MetricFamiliesDiff{
+				Changed: []*MetricFamilyDiff{{
+					Name:          "a",
+					AddedLabels:   []string{"z"},
+					RemovedLabels: []string{"y"},
+					Series:        &SeriesChange{Left: 1, Right: 2},
+				}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := DiffMetricFamilies(parseMetricFamilies(t, c.left), parseMetricFamilies(t, c.right))
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMetricFamiliesDiffText(t *testing.T) {
+	diff := &MetricFamiliesDiff{
+		Added:   []string{"c"},
+		Removed: []string{"a"},
+		Changed: []*MetricFamilyDiff{{
+			Name:          "b",
+			Type:          &ValueChange{Left: "GAUGE", Right: "COUNTER"},
+			AddedLabels:   []string{"z"},
+			RemovedLabels: []string{"y"},
+			Series:        &SeriesChange{Left: 1, Right: 2},
+		}},
+	}
+
+	want := "- a\n+ c\n~ b\n    type: GAUGE -> COUNTER\n    - label y\n    + label z\n    series: 1 -> 2\n"
+	if got := diff.Text(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
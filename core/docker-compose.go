@@ -2,38 +2,417 @@ package core
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 
+	"github.com/compose-spec/compose-go/v2/dotenv"
+	"github.com/google/uuid"
 	"github.com/rotisserie/eris"
+	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/compose"
+	"gopkg.in/yaml.v3"
 )
 
 type DockerCompose struct {
 	compose.ComposeStack
 
+	ProjectName     string
+	ComposeFiles    []string
 	RemoveAllImages bool
+	EphemeralPorts  bool
+
+	profiles       []string
+	generatedDir   string
+	generatedFiles map[string][]byte
+	clientLock     sync.Mutex
+	dockerClient   *testcontainers.DockerClient
 }
 
 func (c *DockerCompose) String() string {
-	return "DockerCompose"
+	return fmt.Sprintf("DockerCompose{Project: %s}", c.ProjectName)
+}
+
+var invalidProjectNameChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// NewProjectName returns a unique compose project name for a config group.
+func NewProjectName(group string) string {
+	name := invalidProjectNameChars.ReplaceAllString(strings.ToLower(group), "-")
+	return fmt.Sprintf("heracles-%s-%s", strings.Trim(name, "-_"), uuid.New().String()[:8])
+}
+
+// ephemeralPort drops the host port of a short syntax port mapping like `[IP:]HOST:CONTAINER[/PROTOCOL]`.
+func ephemeralPort(port string) string {
+	spec, protocol, hasProtocol := strings.Cut(port, "/")
+
+	ip := ""
+	if strings.HasPrefix(spec, "[") {
+		end := strings.Index(spec, "]")
+		if end > 0 {
+			ip, spec = spec[:end+1], strings.TrimPrefix(spec[end+1:], ":")
+		}
+	}
+
+	parts := strings.Split(spec, ":")
+	if ip == "" && len(parts) == 3 {
+		ip = parts[0]
+	}
+
+	result := parts[len(parts)-1]
+	if ip != "" {
+		result = ip + "::" + result
+	}
+
+	if hasProtocol {
+		result += "/" + protocol
+	}
+
+	return result
+}
+
+// mappingValue returns the value node of a key in a yaml mapping node.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// ephemeralPorts drops the host ports of published ports, so that docker picks free ones.
+func ephemeralPorts(ports []*yaml.Node) []*yaml.Node {
+	result := make([]*yaml.Node, 0, len(ports))
+	for _, port := range ports {
+		switch port.Kind {
+		case yaml.ScalarNode:
+			result = append(result, &yaml.Node{
+				Kind: yaml.ScalarNode, Tag: "!!str", Style: yaml.DoubleQuotedStyle, Value: ephemeralPort(port.Value),
+			})
+		case yaml.MappingNode:
+			mapping := &yaml.Node{Kind: yaml.MappingNode}
+			for j := 0; j+1 < len(port.Content); j += 2 {
+				if port.Content[j].Value != "published" {
+					mapping.Content = append(mapping.Content, port.Content[j], port.Content[j+1])
+				}
+			}
+			result = append(result, mapping)
+		default:
+			result = append(result, port)
+		}
+	}
+
+	return result
+}
+
+// profileSelected returns true if one of the profiles of a service is selected, `*` selecting all.
+func profileSelected(profiles []string, selected []string) bool {
+	for _, profile := range profiles {
+		for _, name := range selected {
+			if name == "*" || name == profile {
+				return true
+			}
+		}
+	}
+
+	return false
 }
 
-func NewDockerCompose(composeFilePath string, RemoveAllImages bool) (*DockerCompose, error) {
-	compose, err := compose.NewDockerCompose(composeFilePath)
+// composeService is a service merged from the compose files, as far as its overrides are concerned.
+type composeService struct {
+	name     string
+	ports    []*yaml.Node
+	profiles []string
+}
+
+// composeServices reads the services of compose files, merging their ports and profiles like compose.
+func composeServices(composeFilePaths []string) ([]*composeService, error) {
+	var services []*composeService
+	byName := make(map[string]*composeService)
+	for _, composeFilePath := range composeFilePaths {
+		data, err := os.ReadFile(composeFilePath)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to read compose file: %s", composeFilePath)
+		}
+
+		var document yaml.Node
+		err = yaml.Unmarshal(data, &document)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to parse compose file: %s", composeFilePath)
+		}
+
+		var root *yaml.Node
+		if len(document.Content) != 0 {
+			root = document.Content[0]
+		}
+
+		nodes := mappingValue(root, "services")
+		if nodes == nil || nodes.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for i := 0; i+1 < len(nodes.Content); i += 2 {
+			name := nodes.Content[i].Value
+			service, ok := byName[name]
+			if !ok {
+				service = &composeService{name: name}
+				byName[name] = service
+				services = append(services, service)
+			}
+
+			ports := mappingValue(nodes.Content[i+1], "ports")
+			if ports != nil {
+				switch ports.Tag {
+				case "!reset", "!override":
+					service.ports = nil
+				}
+				if ports.Kind == yaml.SequenceNode {
+					service.ports = append(service.ports, ports.Content...)
+				}
+			}
+
+			profiles := mappingValue(nodes.Content[i+1], "profiles")
+			if profiles != nil {
+				switch profiles.Tag {
+				case "!reset", "!override":
+					service.profiles = nil
+				}
+				for _, profile := range profiles.Content {
+					service.profiles = append(service.profiles, profile.Value)
+				}
+			}
+		}
+	}
+
+	return services, nil
+}
+
+// overrideComposeFile returns a compose file dropping the host ports of the services if ephemeral and
+// the profiles of the services of the selected profiles, so that compose starts them like the services
+// without profiles. Compose merges it into the given files, which are left as they are, so that
+// relative paths keep resolving from the directory of the first one. It returns nothing if nothing is
+// overridden.
+func overrideComposeFile(composeFilePaths []string, ephemeral bool, selected []string) ([]byte, error) {
+	services, err := composeServices(composeFilePaths)
 	if err != nil {
-		return nil, eris.Wrap(err, "failed to create docker compose")
+		return nil, err
+	}
+
+	overrides := &yaml.Node{Kind: yaml.MappingNode}
+	for _, service := range services {
+		override := &yaml.Node{Kind: yaml.MappingNode}
+		if ephemeral && len(service.ports) != 0 {
+			override.Content = append(override.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: "ports"},
+				&yaml.Node{Kind: yaml.SequenceNode, Tag: "!override", Content: ephemeralPorts(service.ports)},
+			)
+		}
+
+		if profileSelected(service.profiles, selected) {
+			override.Content = append(override.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: "profiles"},
+				&yaml.Node{Kind: yaml.SequenceNode, Tag: "!reset", Style: yaml.FlowStyle},
+			)
+		}
+
+		if len(override.Content) != 0 {
+			overrides.Content = append(overrides.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: service.name}, override)
+		}
+	}
+
+	if len(overrides.Content) == 0 {
+		return nil, nil
+	}
+
+	document := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "services"}, overrides,
+	}}
+	data, err := yaml.Marshal(document)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to dump compose file")
+	}
+
+	return data, nil
+}
+
+// LoadComposeEnv returns the variables interpolated in the compose files, read from env files and
+// overridden by the given KEY=VALUE ones.
+func LoadComposeEnv(envFiles []string, overrides []string) (map[string]string, error) {
+	env, err := dotenv.GetEnvFromFile(nil, envFiles)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to read env files")
+	}
+
+	parsed, err := ParseEnv(overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range parsed {
+		env[key] = value
+	}
+
+	return env, nil
+}
+
+// NewDockerCompose creates the stack of compose files, the later ones overriding the earlier ones.
+// The services of the selected profiles are started along with the services without profiles. The
+// compose stack takes no profiles, they are enabled by an override, so COMPOSE_PROFILES is not read
+// and the services of the other profiles are not started even if an enabled service depends on them.
+func NewDockerCompose(
+	composeFilePaths []string, projectName string, RemoveAllImages bool, EphemeralPorts bool,
+	profiles []string, build ComposeBuildConfig,
+) (*DockerCompose, error) {
+	if len(composeFilePaths) == 0 {
+		return nil, eris.New("no compose file")
 	}
-	return &DockerCompose{
-		ComposeStack:    compose,
+
+	dockerCompose := &DockerCompose{
+		ProjectName:     projectName,
+		ComposeFiles:    composeFilePaths,
 		RemoveAllImages: RemoveAllImages,
-	}, nil
+		EphemeralPorts:  EphemeralPorts,
+		profiles:        profiles,
+		// created when the stack is started, only if there is any file to generate
+		generatedDir:   filepath.Join(os.TempDir(), fmt.Sprintf("heracles-%s-%s", projectName, uuid.New().String()[:8])),
+		generatedFiles: make(map[string][]byte),
+	}
+
+	stackFiles := append([]string{}, composeFilePaths...)
+	if EphemeralPorts || len(profiles) != 0 {
+		data, err := overrideComposeFile(composeFilePaths, EphemeralPorts, profiles)
+		if err != nil {
+			return nil, err
+		}
+
+		if data != nil {
+			path := filepath.Join(dockerCompose.generatedDir, "override.yml")
+			dockerCompose.generatedFiles[path] = data
+			stackFiles = append(stackFiles, path)
+		}
+	}
+
+	if !build.Empty() {
+		data, err := buildComposeFile(composeFilePaths, build)
+		if err != nil {
+			return nil, err
+		}
+
+		if data != nil {
+			path := filepath.Join(dockerCompose.generatedDir, "build.yml")
+			dockerCompose.generatedFiles[path] = data
+			stackFiles = append(stackFiles, path)
+		}
+	}
+
+	var err error
+	dockerCompose.ComposeStack, err = compose.NewDockerComposeWith(
+		compose.WithStackFiles(stackFiles...),
+		compose.StackIdentifier(projectName),
+	)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to create docker compose")
+	}
+
+	return dockerCompose, nil
+}
+
+// writeGeneratedFiles writes the compose files generated for the stack before it is started.
+func (c *DockerCompose) writeGeneratedFiles() error {
+	if len(c.generatedFiles) == 0 {
+		return nil
+	}
+
+	err := os.MkdirAll(c.generatedDir, 0755)
+	if err != nil {
+		return eris.Wrap(err, "failed to create directory of generated compose files")
+	}
+
+	for path, data := range c.generatedFiles {
+		err := os.WriteFile(path, data, 0644)
+		if err != nil {
+			c.removeGeneratedFiles()
+			return eris.Wrapf(err, "failed to write compose file: %s", path)
+		}
+	}
 
+	return nil
+}
+
+// removeGeneratedFiles removes the compose files generated for the stack, compose reads them only
+// when the stack is started.
+func (c *DockerCompose) removeGeneratedFiles() {
+	if len(c.generatedFiles) != 0 {
+		_ = os.RemoveAll(c.generatedDir)
+	}
+}
+
+// Services returns the services of the compose files which are started, without profile or of a
+// selected one. The compose project is only loaded when this process starts the stack, the services
+// are read from the compose files so that a stack started by another process is covered too.
+func (c *DockerCompose) Services() ([]string, error) {
+	services, err := composeServices(c.ComposeFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(services))
+	for _, service := range services {
+		if len(service.profiles) == 0 || profileSelected(service.profiles, c.profiles) {
+			names = append(names, service.name)
+		}
+	}
+
+	return names, nil
+}
+
+// DockerClient returns a docker client for the container operations the compose stack does not provide.
+func (c *DockerCompose) DockerClient(ctx context.Context) (*testcontainers.DockerClient, error) {
+	c.clientLock.Lock()
+	defer c.clientLock.Unlock()
+
+	if c.dockerClient != nil {
+		return c.dockerClient, nil
+	}
+
+	dockerClient, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to create docker client")
+	}
+
+	c.dockerClient = dockerClient
+	return dockerClient, nil
+}
+
+// closeDockerClient closes the docker client once the stack is torn down.
+func (c *DockerCompose) closeDockerClient() {
+	c.clientLock.Lock()
+	defer c.clientLock.Unlock()
+
+	if c.dockerClient != nil {
+		_ = c.dockerClient.Close()
+		c.dockerClient = nil
+	}
 }
 
 // Setup starts the docker-compose stack.
 func (c *DockerCompose) Setup(ctx context.Context) error {
-	err := c.Up(
+	err := c.writeGeneratedFiles()
+	if err != nil {
+		return err
+	}
+
+	err = c.Up(
 		ctx, compose.Wait(true), compose.RemoveOrphans(true),
 	)
+	c.removeGeneratedFiles()
 
 	if err != nil {
 		return eris.Wrap(err, "failed to wait for service")
@@ -42,6 +421,11 @@ func (c *DockerCompose) Setup(ctx context.Context) error {
 	return nil
 }
 
+// AlwaysTearDown removes the stack even if it failed to start, some services may be running.
+func (c *DockerCompose) AlwaysTearDown() bool {
+	return true
+}
+
 // TearDown stops and removes the docker-compose stack.
 func (c *DockerCompose) TearDown(ctx context.Context) error {
 	var removeImages compose.RemoveImages
@@ -51,6 +435,9 @@ func (c *DockerCompose) TearDown(ctx context.Context) error {
 		removeImages = compose.RemoveImagesLocal
 	}
 
+	c.removeGeneratedFiles()
+	defer c.closeDockerClient()
+
 	err := c.Down(ctx, compose.RemoveOrphans(true), removeImages)
 	if err != nil {
 		return eris.Wrap(err, "failed to tear down")
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEphemeralPort(t *testing.T) {
+	cases := []struct {
+		port string
+		want string
+	}{
+		{port: "80", want: "80"},
+		{port: "8080:80", want: "80"},
+		{port: "8080:80/udp", want: "80/udp"},
+		{port: "127.0.0.1:8080:80", want: "127.0.0.1::80"},
+		{port: "127.0.0.1::80", want: "127.0.0.1::80"},
+		{port: "127.0.0.1:8080:80/tcp", want: "127.0.0.1::80/tcp"},
+		{port: "[::1]:8080:80", want: "[::1]::80"},
+		{port: "[::1]::80/udp", want: "[::1]::80/udp"},
+		{port: "8000-8010:8000-8010", want: "8000-8010"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.port, func(t *testing.T) {
+			if got := ephemeralPort(c.port); got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestOverrideComposeFile(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "docker-compose.yml")
+	next := filepath.Join(dir, "docker-compose.next.yml")
+
+	err := os.WriteFile(base, []byte(`services:
+  web:
+    build: ./web
+    ports:
+      - "8080:80"
+  debug:
+    image: busybox
+    profiles: [debug]
+    ports:
+      - target: 70
+        published: 7070
+  other:
+    image: busybox
+    profiles: [other]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(next, []byte(`services:
+  web:
+    ports:
+      - "127.0.0.1:6060:60"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		ephemeral bool
+		profiles  []string
+		want      string
+	}{
+		{
+			name: "nothing",
+		},
+		{
+			name:      "ephemeral",
+			ephemeral: true,
+			want: `services:
+    web:
+        ports: !override
+            - "80"
+            - "127.0.0.1::60"
+    debug:
+        ports: !override
+            - target: 70
+`,
+		},
+		{
+			name:     "profiles",
+			profiles: []string{"debug"},
+			want: `services:
+    debug:
+        profiles: !reset []
+`,
+		},
+		{
+			name:     "all profiles",
+			profiles: []string{"*"},
+			want: `services:
+    debug:
+        profiles: !reset []
+    other:
+        profiles: !reset []
+`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := overrideComposeFile([]string{base, next}, c.ephemeral, c.profiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := string(data); got != c.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestNewDockerComposeGeneratesNoFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docker-compose.yml")
+	err := os.WriteFile(path, []byte("services:\n  web:\n    image: busybox\n    ports:\n      - \"8080:80\"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dockerCompose, err := NewDockerCompose([]string{path}, NewProjectName("test"), false, true, nil, ComposeBuildConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dockerCompose.generatedFiles) == 0 {
+		t.Fatal("override expected")
+	}
+
+	// the files are only written when the stack is started
+	_, err = os.Stat(dockerCompose.generatedDir)
+	if !os.IsNotExist(err) {
+		t.Errorf("directory of generated files created: %v", err)
+	}
+}
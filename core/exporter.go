@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/docker/go-connections/nat"
 	"github.com/rotisserie/eris"
 )
 
@@ -18,11 +19,21 @@ type DockerComposeExporter struct {
 
 // Start wait for the service to be ready and returns the endpoint.
 func (e *DockerComposeExporter) Start(ctx context.Context) (string, error) {
-	_, err := e.dockerCompose.ServiceContainer(ctx, e.exporterService)
+	container, err := e.dockerCompose.ServiceContainer(ctx, e.exporterService)
 	if err != nil {
 		return "", eris.Wrap(err, "failed to get service container")
 	}
 
+	port := e.exporterPort
+	if e.dockerCompose.EphemeralPorts {
+		// the exporter port is the container port when docker picks the host ports
+		mappedPort, err := container.MappedPort(ctx, nat.Port(e.exporterPort))
+		if err != nil {
+			return "", eris.Wrapf(err, "failed to get mapped port %s of service: %s", e.exporterPort, e.exporterService)
+		}
+		port = mappedPort.Port()
+	}
+
 	//strategy := wait.ForHealthCheck().WithStartupTimeout(e.startupTimeout)
 	//err = strategy.WaitUntilReady(ctx, container)
 	//if err != nil {
@@ -30,7 +41,7 @@ func (e *DockerComposeExporter) Start(ctx context.Context) (string, error) {
 	//}
 
 	//endpoint, err := container.Endpoint(ctx, "http")
-	endpoint := fmt.Sprintf("http://%s:%s", e.exporterHost, e.exporterPort)
+	endpoint := fmt.Sprintf("http://%s:%s", e.exporterHost, port)
 	if err != nil {
 		return "", eris.Wrap(err, "failed to get endpoint")
 	}
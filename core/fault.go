@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/mrlyc/heracles/log"
+	"github.com/rotisserie/eris"
+)
+
+// ServiceActionConfig changes the state of a compose service in the middle of a run.
+type ServiceActionConfig struct {
+	Service string        `mapstructure:"service"`
+	Action  string        `mapstructure:"action"`
+	Signal  string        `mapstructure:"signal"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// ServiceActionFixture stops, starts, restarts, pauses, unpauses or kills a compose service on setup,
+// tearing down does nothing since the compose stack is removed at the end of the run.
+type ServiceActionFixture struct {
+	dockerCompose *DockerCompose
+	Service       string
+	Action        string
+	Signal        string
+	Timeout       time.Duration
+}
+
+func (s *ServiceActionFixture) String() string {
+	return fmt.Sprintf("ServiceActionFixture{Service: %s, Action: %s}", s.Service, s.Action)
+}
+
+func (s *ServiceActionFixture) stopOptions() container.StopOptions {
+	var options container.StopOptions
+	if s.Timeout > 0 {
+		timeout := int(s.Timeout.Seconds())
+		options.Timeout = &timeout
+	}
+	return options
+}
+
+func (s *ServiceActionFixture) Setup(ctx context.Context) error {
+	serviceContainer, err := s.dockerCompose.ServiceContainer(ctx, s.Service)
+	if err != nil {
+		return eris.Wrapf(err, "failed to get container of service: %s", s.Service)
+	}
+
+	dockerClient, err := s.dockerCompose.DockerClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.FromContext(ctx).Infof("%s service %s", s.Action, s.Service)
+
+	id := serviceContainer.GetContainerID()
+	switch s.Action {
+	case "stop":
+		err = dockerClient.ContainerStop(ctx, id, s.stopOptions())
+	case "start":
+		err = dockerClient.ContainerStart(ctx, id, container.StartOptions{})
+	case "restart":
+		err = dockerClient.ContainerRestart(ctx, id, s.stopOptions())
+	case "pause":
+		err = dockerClient.ContainerPause(ctx, id)
+	case "unpause":
+		err = dockerClient.ContainerUnpause(ctx, id)
+	case "kill":
+		err = dockerClient.ContainerKill(ctx, id, s.Signal)
+	}
+
+	if err != nil {
+		return eris.Wrapf(err, "failed to %s service: %s", s.Action, s.Service)
+	}
+
+	return nil
+}
+
+func (s *ServiceActionFixture) TearDown(ctx context.Context) error {
+	return nil
+}
+
+func NewServiceActionFixture(dockerCompose *DockerCompose, config ServiceActionConfig) (*ServiceActionFixture, error) {
+	switch config.Action {
+	case "stop", "start", "restart", "pause", "unpause", "kill":
+	default:
+		return nil, eris.Errorf("unknown action %q of service: %s", config.Action, config.Service)
+	}
+
+	return &ServiceActionFixture{
+		dockerCompose: dockerCompose,
+		Service:       config.Service,
+		Action:        config.Action,
+		Signal:        config.Signal,
+		Timeout:       config.Timeout,
+	}, nil
+}
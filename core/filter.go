@@ -0,0 +1,156 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rotisserie/eris"
+)
+
+// LabelMatcher matches a label value, written as `name=value`, `name!=value`, `name=~regex` or `name!~regex`.
+// A missing label matches as an empty value.
+type LabelMatcher struct {
+	Name     string
+	Operator string
+	Value    string
+	regexp   *regexp.Regexp
+}
+
+func (m *LabelMatcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Operator, m.Value)
+}
+
+func (m *LabelMatcher) Matches(value string) bool {
+	switch m.Operator {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~":
+		return m.regexp.MatchString(value)
+	case "!~":
+		return !m.regexp.MatchString(value)
+	}
+	return false
+}
+
+func ParseLabelMatcher(matcher string) (*LabelMatcher, error) {
+	index := strings.IndexAny(matcher, "=!")
+	if index <= 0 {
+		return nil, eris.Errorf("invalid label matcher: %s", matcher)
+	}
+
+	m := &LabelMatcher{Name: matcher[:index]}
+	rest := matcher[index:]
+	for _, operator := range []string{"=~", "!~", "!=", "="} {
+		if strings.HasPrefix(rest, operator) {
+			m.Operator = operator
+			m.Value = rest[len(operator):]
+			break
+		}
+	}
+
+	switch m.Operator {
+	case "":
+		return nil, eris.Errorf("invalid label matcher: %s", matcher)
+	case "=~", "!~":
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid label matcher regex: %s", matcher)
+		}
+		m.regexp = re
+	}
+
+	return m, nil
+}
+
+// MetricFamiliesFilter selects metric families by name and their series by labels.
+type MetricFamiliesFilter struct {
+	names  []*regexp.Regexp
+	labels []*LabelMatcher
+}
+
+func (f *MetricFamiliesFilter) matchName(name string) bool {
+	if len(f.names) == 0 {
+		return true
+	}
+
+	for _, re := range f.names {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *MetricFamiliesFilter) matchLabels(metric *dto.Metric) bool {
+	for _, matcher := range f.labels {
+		value := ""
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == matcher.Name {
+				value = label.GetValue()
+				break
+			}
+		}
+
+		if !matcher.Matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the matching metric families, families without any matching series are dropped.
+func (f *MetricFamiliesFilter) Filter(metricFamilies map[string]*dto.MetricFamily) map[string]*dto.MetricFamily {
+	filtered := make(map[string]*dto.MetricFamily)
+	for name, metricFamily := range metricFamilies {
+		if !f.matchName(name) {
+			continue
+		}
+
+		var metrics []*dto.Metric
+		for _, metric := range metricFamily.GetMetric() {
+			if f.matchLabels(metric) {
+				metrics = append(metrics, metric)
+			}
+		}
+
+		if len(metrics) == 0 {
+			continue
+		}
+
+		filtered[name] = &dto.MetricFamily{
+			Name:   metricFamily.Name,
+			Help:   metricFamily.Help,
+			Type:   metricFamily.Type,
+			Metric: metrics,
+		}
+	}
+
+	return filtered
+}
+
+// NewMetricFamiliesFilter creates a filter from metric name regexes and label matchers.
+func NewMetricFamiliesFilter(names []string, labels []string) (*MetricFamiliesFilter, error) {
+	filter := &MetricFamiliesFilter{}
+
+	for _, name := range names {
+		re, err := regexp.Compile("^(?:" + name + ")$")
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid metric name regex: %s", name)
+		}
+		filter.names = append(filter.names, re)
+	}
+
+	for _, label := range labels {
+		matcher, err := ParseLabelMatcher(label)
+		if err != nil {
+			return nil, err
+		}
+		filter.labels = append(filter.labels, matcher)
+	}
+
+	return filter, nil
+}
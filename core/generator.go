@@ -0,0 +1,49 @@
+package core
+
+import (
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// GenerateMetricsConfig builds a metrics config list describing every scraped metric family.
+// When withSamples is set, each series becomes a sample assertion, optionally including its value.
+func GenerateMetricsConfig(metricFamilies map[string]*dto.MetricFamily, withSamples bool, withValues bool) []MetricsConfig {
+	metrics := make([]MetricsConfig, 0, len(metricFamilies))
+	for name, metricFamily := range metricFamilies {
+		config := MetricsConfig{
+			Name:   name,
+			Type:   strings.ToLower(metricFamily.GetType().String()),
+			Labels: metricFamilyLabelNames(metricFamily),
+		}
+
+		if withSamples {
+			for _, metric := range metricFamily.GetMetric() {
+				sample := MetricSample{}
+				if len(metric.GetLabel()) != 0 {
+					sample.Labels = make(map[string]string, len(metric.GetLabel()))
+					for _, label := range metric.GetLabel() {
+						sample.Labels[label.GetName()] = label.GetValue()
+					}
+				}
+
+				if withValues {
+					if value, ok := metricValue(metric); ok {
+						sample.Value = &value
+					}
+				}
+
+				config.Samples = append(config.Samples, sample)
+			}
+		}
+
+		metrics = append(metrics, config)
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Name < metrics[j].Name
+	})
+
+	return metrics
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerateMetricsConfig(t *testing.T) {
+	metrics := `# TYPE pg_up gauge
+pg_up 1
+# TYPE pg_db counter
+pg_db{datname="b"} 4
+pg_db{datname="a",schema="public"} 3
+`
+
+	three, four, one := 3.0, 4.0, 1.0
+	cases := []struct {
+		name        string
+		withSamples bool
+		withValues  bool
+		want        []MetricsConfig
+	}{
+		{
+			name: "families",
+			want: []MetricsConfig{
+				{Name: "pg_db", Type: "counter", Labels: []string{"datname", "schema"}},
+				{Name: "pg_up", Type: "gauge", Labels: []string{}},
+			},
+		},
+		{
+			name:        "samples",
+			withSamples: true,
+			want: []MetricsConfig{
+				{Name: "pg_db", Type: "counter", Labels: []string{"datname", "schema"}, Samples: []MetricSample{
+					{Labels: map[string]string{"datname": "b"}},
+					{Labels: map[string]string{"datname": "a", "schema": "public"}},
+				}},
+				{Name: "pg_up", Type: "gauge", Labels: []string{}, Samples: []MetricSample{{}}},
+			},
+		},
+		{
+			name:        "values",
+			withSamples: true,
+			withValues:  true,
+			want: []MetricsConfig{
+				{Name: "pg_db", Type: "counter", Labels: []string{"datname", "schema"}, Samples: []MetricSample{
+					{Labels: map[string]string{"datname": "b"}, Value: &four},
+					{Labels: map[string]string{"datname": "a", "schema": "public"}, Value: &three},
+				}},
+				{Name: "pg_up", Type: "gauge", Labels: []string{}, Samples: []MetricSample{{Value: &one}}},
+			},
+		},
+		{
+			name:       "values without samples",
+			withValues: true,
+			want: []MetricsConfig{
+				{Name: "pg_db", Type: "counter", Labels: []string{"datname", "schema"}},
+				{Name: "pg_up", Type: "gauge", Labels: []string{}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := GenerateMetricsConfig(parseMetricFamilies(t, metrics), c.withSamples, c.withValues)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
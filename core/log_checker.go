@@ -0,0 +1,308 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rotisserie/eris"
+)
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid log pattern: %s", pattern)
+		}
+		compiled = append(compiled, regex)
+	}
+
+	return compiled, nil
+}
+
+func patternStrings(patterns []*regexp.Regexp) []string {
+	strs := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		strs = append(strs, pattern.String())
+	}
+	return strs
+}
+
+func logLines(logs string) []string {
+	return strings.Split(strings.TrimRight(logs, "\n"), "\n")
+}
+
+// LogErrorPatternChecker fails when a line of the logs matches one of the error patterns.
+type LogErrorPatternChecker struct {
+	patterns []*regexp.Regexp
+}
+
+func (c *LogErrorPatternChecker) String() string {
+	return fmt.Sprintf("LogErrorPatternChecker{patterns: %v}", patternStrings(c.patterns))
+}
+
+func (c *LogErrorPatternChecker) Check(logs string) (bool, string) {
+	for _, line := range logLines(logs) {
+		for _, pattern := range c.patterns {
+			if pattern.MatchString(line) {
+				return false, fmt.Sprintf("log line matches error pattern %s: %s", pattern, line)
+			}
+		}
+	}
+	return true, okMessage
+}
+
+func NewLogErrorPatternChecker(patterns []string) (*LogErrorPatternChecker, error) {
+	compiled, err := compilePatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogErrorPatternChecker{
+		patterns: compiled,
+	}, nil
+}
+
+// LogPatternAppearChecker fails when one of the patterns matches no line of the logs.
+type LogPatternAppearChecker struct {
+	patterns []*regexp.Regexp
+}
+
+func (c *LogPatternAppearChecker) String() string {
+	return fmt.Sprintf("LogPatternAppearChecker{patterns: %v}", patternStrings(c.patterns))
+}
+
+func (c *LogPatternAppearChecker) Check(logs string) (bool, string) {
+	lines := logLines(logs)
+	for _, pattern := range c.patterns {
+		found := false
+		for _, line := range lines {
+			if pattern.MatchString(line) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false, fmt.Sprintf("no log line matches pattern %s", pattern)
+		}
+	}
+	return true, okMessage
+}
+
+func NewLogPatternAppearChecker(patterns []string) (*LogPatternAppearChecker, error) {
+	compiled, err := compilePatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogPatternAppearChecker{
+		patterns: compiled,
+	}, nil
+}
+
+// parseLogfmt parses a logfmt line like `level=info msg="listening on :9187"`. A line without any
+// key=value pair is plain text, not a logfmt line of bare keys.
+func parseLogfmt(line string) (map[string]string, bool) {
+	fields := make(map[string]string)
+	pairs := 0
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimLeft(line, " ") {
+		equal := strings.IndexAny(line, "= ")
+		if equal == 0 {
+			return nil, false
+		} else if equal < 0 {
+			equal = len(line)
+		}
+
+		key := line[:equal]
+		line = line[equal:]
+		if !strings.HasPrefix(line, "=") {
+			// a key without value
+			fields[key] = ""
+			continue
+		}
+		line = line[1:]
+		pairs++
+
+		if strings.HasPrefix(line, `"`) {
+			end := 1
+			for ; end < len(line); end++ {
+				if line[end] == '\\' {
+					end++
+				} else if line[end] == '"' {
+					break
+				}
+			}
+			if end >= len(line) {
+				return nil, false
+			}
+
+			var value string
+			err := json.Unmarshal([]byte(line[:end+1]), &value)
+			if err != nil {
+				return nil, false
+			}
+			fields[key] = value
+			line = line[end+1:]
+		} else {
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+			fields[key] = line[:end]
+			line = line[end:]
+		}
+	}
+
+	return fields, pairs > 0
+}
+
+// parseJSONLog parses a JSON line, nested values are kept as JSON.
+func parseJSONLog(line string) (map[string]string, bool) {
+	var values map[string]interface{}
+	err := json.Unmarshal([]byte(line), &values)
+	if err != nil {
+		return nil, false
+	}
+
+	fields := make(map[string]string, len(values))
+	for key, value := range values {
+		switch value := value.(type) {
+		case string:
+			fields[key] = value
+		default:
+			data, _ := json.Marshal(value)
+			fields[key] = string(data)
+		}
+	}
+
+	return fields, true
+}
+
+// LogFieldsChecker parses structured log lines and asserts that a line with matching fields
+// appears, or with absent that none does. Lines which are not structured are skipped.
+type LogFieldsChecker struct {
+	format string
+	match  map[string]*regexp.Regexp
+	absent bool
+}
+
+func (c *LogFieldsChecker) String() string {
+	keys := make([]string, 0, len(c.match))
+	for key := range c.match {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	match := make([]string, 0, len(keys))
+	for _, key := range keys {
+		match = append(match, fmt.Sprintf("%s=~%s", key, c.match[key]))
+	}
+
+	return fmt.Sprintf("LogFieldsChecker{format: %s, match: {%s}, absent: %v}", c.format, strings.Join(match, ", "), c.absent)
+}
+
+func (c *LogFieldsChecker) matchLine(line string) bool {
+	var (
+		fields map[string]string
+		ok     bool
+	)
+	if c.format == "json" {
+		fields, ok = parseJSONLog(line)
+	} else {
+		fields, ok = parseLogfmt(line)
+	}
+	if !ok {
+		return false
+	}
+
+	for key, pattern := range c.match {
+		value, ok := fields[key]
+		if !ok || !pattern.MatchString(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *LogFieldsChecker) Check(logs string) (bool, string) {
+	for _, line := range logLines(logs) {
+		if !c.matchLine(line) {
+			continue
+		}
+
+		if c.absent {
+			return false, fmt.Sprintf("log line with matching fields found: %s", line)
+		}
+		return true, okMessage
+	}
+
+	if c.absent {
+		return true, okMessage
+	}
+	return false, "no log line with matching fields"
+}
+
+func NewLogFieldsChecker(format string, match map[string]string, absent bool) (*LogFieldsChecker, error) {
+	switch format {
+	case "json", "logfmt":
+	default:
+		return nil, eris.Errorf("unknown log format: %q", format)
+	}
+
+	if len(match) == 0 {
+		return nil, eris.New("no log field to match")
+	}
+
+	compiled := make(map[string]*regexp.Regexp, len(match))
+	for key, pattern := range match {
+		// the values match as a whole, like the label values of prometheus
+		regex, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid pattern of log field: %s", key)
+		}
+		compiled[key] = regex
+	}
+
+	return &LogFieldsChecker{
+		format: format,
+		match:  compiled,
+		absent: absent,
+	}, nil
+}
+
+// BuildLogsCheckers builds the checkers of the exporter logs.
+func BuildLogsCheckers(config LogsConfig) ([]LogsChecker, error) {
+	var checkers []LogsChecker
+
+	mustNotAppear := append(append([]string{}, config.ErrorPatterns...), config.MustNotAppear...)
+	if len(mustNotAppear) != 0 {
+		checker, err := NewLogErrorPatternChecker(mustNotAppear)
+		if err != nil {
+			return nil, err
+		}
+		checkers = append(checkers, checker)
+	}
+
+	if len(config.MustAppear) != 0 {
+		checker, err := NewLogPatternAppearChecker(config.MustAppear)
+		if err != nil {
+			return nil, err
+		}
+		checkers = append(checkers, checker)
+	}
+
+	for _, fields := range config.Fields {
+		checker, err := NewLogFieldsChecker(config.Format, fields.Match, fields.Absent)
+		if err != nil {
+			return nil, err
+		}
+		checkers = append(checkers, checker)
+	}
+
+	return checkers, nil
+}
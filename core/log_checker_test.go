@@ -0,0 +1,128 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLogfmt(t *testing.T) {
+	cases := []struct {
+		name   string
+		line   string
+		want   map[string]string
+		wantOk bool
+	}{
+		{
+			name:   "pairs",
+			line:   `level=info msg="listening on :9187" port=9187`,
+			want:   map[string]string{"level": "info", "msg": "listening on :9187", "port": "9187"},
+			wantOk: true,
+		},
+		{
+			name:   "escaped quote",
+			line:   `msg="say \"hi\"" level=debug`,
+			want:   map[string]string{"msg": `say "hi"`, "level": "debug"},
+			wantOk: true,
+		},
+		{
+			name:   "empty value",
+			line:   `level= msg=""`,
+			want:   map[string]string{"level": "", "msg": ""},
+			wantOk: true,
+		},
+		{
+			name:   "bare keys",
+			line:   `level=warn deprecated`,
+			want:   map[string]string{"level": "warn", "deprecated": ""},
+			wantOk: true,
+		},
+		{
+			name: "plain text",
+			line: "Starting exporter version 1.0",
+		},
+		{
+			name: "empty",
+			line: "  ",
+		},
+		{
+			name: "missing key",
+			line: "=value",
+		},
+		{
+			name: "unterminated quote",
+			line: `msg="listening`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := parseLogfmt(c.line)
+			if ok != c.wantOk {
+				t.Fatalf("got ok %v, want %v", ok, c.wantOk)
+			}
+			if ok && !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLogFieldsChecker(t *testing.T) {
+	logs := "Starting exporter\nlevel=info msg=started\nlevel=error msg=\"scrape failed\"\n"
+
+	cases := []struct {
+		name   string
+		format string
+		match  map[string]string
+		absent bool
+		logs   string
+		want   bool
+	}{
+		{name: "appears", format: "logfmt", match: map[string]string{"level": "info"}, logs: logs, want: true},
+		{name: "missing", format: "logfmt", match: map[string]string{"level": "warn"}, logs: logs},
+		{name: "whole value", format: "logfmt", match: map[string]string{"msg": "scrape"}, logs: logs},
+		{name: "regex", format: "logfmt", match: map[string]string{"msg": "scrape.*"}, logs: logs, want: true},
+		{name: "absent", format: "logfmt", match: map[string]string{"level": "warn"}, absent: true, logs: logs, want: true},
+		{name: "not absent", format: "logfmt", match: map[string]string{"level": "error"}, absent: true, logs: logs},
+		{name: "plain text skipped", format: "logfmt", match: map[string]string{"Starting": ""}, absent: true, logs: logs, want: true},
+		{
+			name: "json", format: "json", match: map[string]string{"level": "info", "port": "9187"},
+			logs: "{\"level\":\"info\",\"port\":9187}\nlevel=info port=9187\n", want: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checker, err := NewLogFieldsChecker(c.format, c.match, c.absent)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, message := checker.Check(c.logs)
+			if got != c.want {
+				t.Errorf("got %v (%s), want %v", got, message, c.want)
+			}
+		})
+	}
+}
+
+func TestNewLogFieldsCheckerInvalid(t *testing.T) {
+	cases := []struct {
+		name   string
+		format string
+		match  map[string]string
+	}{
+		{name: "unknown format", format: "xml", match: map[string]string{"level": "info"}},
+		{name: "empty match", format: "logfmt"},
+		{name: "invalid pattern", format: "json", match: map[string]string{"level": "("}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewLogFieldsChecker(c.format, c.match, false)
+			if err == nil {
+				t.Error("error expected")
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/mrlyc/heracles/log"
+	"github.com/rotisserie/eris"
+)
+
+// LogsConfig collects the logs of compose services and checks the logs of the exporter.
+type LogsConfig struct {
+	Dir           string            `mapstructure:"dir"`
+	Services      []string          `mapstructure:"services"`
+	ErrorPatterns []string          `mapstructure:"error_patterns"`
+	MustAppear    []string          `mapstructure:"must_appear"`
+	MustNotAppear []string          `mapstructure:"must_not_appear"`
+	Format        string            `mapstructure:"format"`
+	Fields        []LogFieldsConfig `mapstructure:"fields"`
+}
+
+// LogFieldsConfig asserts the structured log lines whose fields match, each value being a regex.
+type LogFieldsConfig struct {
+	Match  map[string]string `mapstructure:"match"`
+	Absent bool              `mapstructure:"absent"`
+}
+
+// ServiceLogs returns the stdout and stderr of a compose service, interleaved.
+func (c *DockerCompose) ServiceLogs(ctx context.Context, service string) (string, error) {
+	serviceContainer, err := c.ServiceContainer(ctx, service)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to get container of service: %s", service)
+	}
+
+	dockerClient, err := c.DockerClient(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	reader, err := dockerClient.ContainerLogs(ctx, serviceContainer.GetContainerID(), container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to get logs of service: %s", service)
+	}
+	defer reader.Close()
+
+	var logs bytes.Buffer
+	_, err = stdcopy.StdCopy(&logs, &logs, reader)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to read logs of service: %s", service)
+	}
+
+	return logs.String(), nil
+}
+
+// ServiceLogsFixture writes the logs of compose services into the artifacts directory when it is
+// torn down, which is right before the compose stack.
+type ServiceLogsFixture struct {
+	dockerCompose *DockerCompose
+	Dir           string
+	Services      []string
+
+	artifacts map[string]string
+}
+
+func (s *ServiceLogsFixture) String() string {
+	return fmt.Sprintf("ServiceLogsFixture{Dir: %s, Services: %v}", s.Dir, s.Services)
+}
+
+// Artifacts returns the log files written, by service.
+func (s *ServiceLogsFixture) Artifacts() map[string]string {
+	return s.artifacts
+}
+
+func (s *ServiceLogsFixture) Setup(ctx context.Context) error {
+	return nil
+}
+
+func (s *ServiceLogsFixture) TearDown(ctx context.Context) error {
+	services := s.Services
+	if len(services) == 0 {
+		var err error
+		services, err = s.dockerCompose.Services()
+		if err != nil {
+			return err
+		}
+	}
+
+	dir := filepath.Join(s.Dir, s.dockerCompose.ProjectName)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return eris.Wrapf(err, "failed to create artifacts directory: %s", dir)
+	}
+
+	s.artifacts = make(map[string]string, len(services))
+	for _, service := range services {
+		logs, err := s.dockerCompose.ServiceLogs(ctx, service)
+		if err != nil {
+			// a service may have exited or never started, the others are still worth keeping
+			log.FromContext(ctx).Warnf("failed to collect logs: %v", err)
+			continue
+		}
+
+		path := filepath.Join(dir, service+".log")
+		err = os.WriteFile(path, []byte(logs), 0644)
+		if err != nil {
+			return eris.Wrapf(err, "failed to write logs of service: %s", service)
+		}
+
+		log.FromContext(ctx).Infof("logs of service %s written to %s", service, path)
+		s.artifacts[service] = path
+	}
+
+	return nil
+}
+
+func NewServiceLogsFixture(dockerCompose *DockerCompose, dir string, services []string) *ServiceLogsFixture {
+	return &ServiceLogsFixture{
+		dockerCompose: dockerCompose,
+		Dir:           dir,
+		Services:      services,
+	}
+}
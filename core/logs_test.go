@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mrlyc/heracles/log"
+)
+
+func TestServiceLogsFixtureTearDownNotStarted(t *testing.T) {
+	log.UpdateDefaultLogger()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "docker-compose.yml")
+	err := os.WriteFile(path, []byte(`services:
+  exporter:
+    image: busybox
+  postgres:
+    image: busybox
+  debug:
+    image: busybox
+    profiles: [debug]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dockerCompose, err := NewDockerCompose([]string{path}, NewProjectName("test"), false, false, nil, ComposeBuildConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := dockerCompose.Services()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"exporter", "postgres"}; !reflect.DeepEqual(services, want) {
+		t.Errorf("got services %v, want %v", services, want)
+	}
+
+	// the stack was not started by this compose, like with the down command
+	fixture := NewServiceLogsFixture(dockerCompose, filepath.Join(dir, "artifacts"), nil)
+	err = fixture.TearDown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fixture.Artifacts()) != 0 {
+		t.Errorf("unexpected artifacts: %v", fixture.Artifacts())
+	}
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rotisserie/eris"
+)
+
+// MatrixVariable is a variable of the matrix of a group, which runs once for each combination of
+// the values of its variables.
+type MatrixVariable struct {
+	Name   string   `mapstructure:"name"`
+	Values []string `mapstructure:"values"`
+}
+
+// ExpandMatrix returns the cells of a matrix as KEY=VALUE lists, the last variable varying fastest.
+func ExpandMatrix(variables []MatrixVariable) ([][]string, error) {
+	if len(variables) == 0 {
+		return nil, nil
+	}
+
+	names := make(map[string]bool, len(variables))
+	for _, variable := range variables {
+		switch {
+		case variable.Name == "" || strings.ContainsAny(variable.Name, "=;[]"):
+			return nil, eris.Errorf("invalid matrix variable: %q", variable.Name)
+		case names[variable.Name]:
+			return nil, eris.Errorf("duplicated matrix variable: %s", variable.Name)
+		case len(variable.Values) == 0:
+			return nil, eris.Errorf("matrix variable %s has no values", variable.Name)
+		}
+		names[variable.Name] = true
+
+		for _, value := range variable.Values {
+			if strings.ContainsAny(value, ";[]") {
+				return nil, eris.Errorf("invalid value of matrix variable %s: %q", variable.Name, value)
+			}
+		}
+	}
+
+	cells := [][]string{nil}
+	for _, variable := range variables {
+		expanded := make([][]string, 0, len(cells)*len(variable.Values))
+		for _, cell := range cells {
+			for _, value := range variable.Values {
+				item := append(append([]string{}, cell...), variable.Name+"="+value)
+				expanded = append(expanded, item)
+			}
+		}
+		cells = expanded
+	}
+
+	return cells, nil
+}
+
+// MatrixGroup returns the name of the virtual group of a matrix cell, like `exporter[PG=12;EXPORTER=v1]`.
+// The variables are not separated by commas, which separate the groups of the --group flag.
+func MatrixGroup(group string, cell []string) string {
+	if len(cell) == 0 {
+		return group
+	}
+	return fmt.Sprintf("%s[%s]", group, strings.Join(cell, ";"))
+}
+
+// ParseMatrixGroup splits the name of a virtual group into its group and matrix cell.
+func ParseMatrixGroup(name string) (string, []string) {
+	start := strings.Index(name, "[")
+	if start <= 0 || !strings.HasSuffix(name, "]") {
+		return name, nil
+	}
+
+	return name[:start], strings.Split(name[start+1:len(name)-1], ";")
+}
+
+// MatrixCellReport is the outcome of a matrix cell.
+type MatrixCellReport struct {
+	Group  string   `yaml:"group"`
+	Values []string `yaml:"values"`
+	Result string   `yaml:"result"`
+}
+
+const (
+	MatrixCellPassed  = "passed"
+	MatrixCellFailed  = "failed"
+	MatrixCellCrashed = "crashed"
+	// MatrixCellTeardownFailed is a cell which passed, but failed to tear down.
+	MatrixCellTeardownFailed = "teardown-failed"
+)
+
+// MatrixReport summarizes the cells of the matrix of a group.
+type MatrixReport struct {
+	Variables []string            `yaml:"variables"`
+	Cells     []*MatrixCellReport `yaml:"cells"`
+}
+
+// Add records the outcome of a cell, whose virtual group is checked.
+func (m *MatrixReport) Add(group string, cell []string, err error) {
+	result := MatrixCellPassed
+	switch {
+	case err == nil:
+	case eris.Cause(err) == ErrCheck:
+		result = MatrixCellFailed
+	case eris.Cause(err) == ErrTeardown:
+		result = MatrixCellTeardownFailed
+	default:
+		result = MatrixCellCrashed
+	}
+
+	values := make([]string, 0, len(cell))
+	for _, item := range cell {
+		name, value, _ := strings.Cut(item, "=")
+		if len(m.Cells) == 0 {
+			m.Variables = append(m.Variables, name)
+		}
+		values = append(values, value)
+	}
+
+	m.Cells = append(m.Cells, &MatrixCellReport{
+		Group:  group,
+		Values: values,
+		Result: result,
+	})
+}
+
+// Text returns the grid of the results, the last variable in columns and the others in rows.
+func (m *MatrixReport) Text() string {
+	if len(m.Variables) == 0 {
+		return ""
+	}
+
+	last := len(m.Variables) - 1
+
+	var (
+		rows    []string
+		columns []string
+		results = make(map[[2]string]string)
+	)
+	for _, cell := range m.Cells {
+		if len(cell.Values) != len(m.Variables) {
+			continue
+		}
+
+		row := make([]string, 0, last)
+		for i, value := range cell.Values[:last] {
+			row = append(row, m.Variables[i]+"="+value)
+		}
+
+		key := [2]string{strings.Join(row, ","), cell.Values[last]}
+		if !slices.Contains(rows, key[0]) {
+			rows = append(rows, key[0])
+		}
+		if !slices.Contains(columns, key[1]) {
+			columns = append(columns, key[1])
+		}
+		results[key] = cell.Result
+	}
+
+	var builder strings.Builder
+	writer := tabwriter.NewWriter(&builder, 0, 4, 2, ' ', 0)
+
+	for _, column := range columns {
+		_, _ = fmt.Fprintf(writer, "\t%s=%s", m.Variables[last], column)
+	}
+	_, _ = fmt.Fprintln(writer)
+
+	for _, row := range rows {
+		_, _ = fmt.Fprint(writer, row)
+		for _, column := range columns {
+			result, ok := results[[2]string{row, column}]
+			if !ok {
+				result = "-"
+			}
+			_, _ = fmt.Fprintf(writer, "\t%s", result)
+		}
+		_, _ = fmt.Fprintln(writer)
+	}
+	_ = writer.Flush()
+
+	return builder.String()
+}
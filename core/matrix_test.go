@@ -0,0 +1,116 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandMatrix(t *testing.T) {
+	cases := []struct {
+		name      string
+		variables []MatrixVariable
+		want      [][]string
+		wantErr   bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:      "one cell",
+			variables: []MatrixVariable{{Name: "PG", Values: []string{"12"}}},
+			want:      [][]string{{"PG=12"}},
+		},
+		{
+			name: "last varies fastest",
+			variables: []MatrixVariable{
+				{Name: "PG", Values: []string{"12", "16"}},
+				{Name: "EXPORTER", Values: []string{"v1", "v2"}},
+			},
+			want: [][]string{
+				{"PG=12", "EXPORTER=v1"},
+				{"PG=12", "EXPORTER=v2"},
+				{"PG=16", "EXPORTER=v1"},
+				{"PG=16", "EXPORTER=v2"},
+			},
+		},
+		{
+			name:      "value with equal sign",
+			variables: []MatrixVariable{{Name: "ARGS", Values: []string{"--a=b"}}},
+			want:      [][]string{{"ARGS=--a=b"}},
+		},
+		{
+			name:      "no name",
+			variables: []MatrixVariable{{Values: []string{"1"}}},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid name",
+			variables: []MatrixVariable{{Name: "A=B", Values: []string{"1"}}},
+			wantErr:   true,
+		},
+		{
+			name: "duplicated name",
+			variables: []MatrixVariable{
+				{Name: "PG", Values: []string{"12"}},
+				{Name: "PG", Values: []string{"16"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:      "no values",
+			variables: []MatrixVariable{{Name: "PG"}},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid value",
+			variables: []MatrixVariable{{Name: "PG", Values: []string{"12;16"}}},
+			wantErr:   true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ExpandMatrix(c.variables)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("got error %v, want error %v", err, c.wantErr)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseMatrixGroup(t *testing.T) {
+	cases := []struct {
+		name      string
+		wantGroup string
+		wantCell  []string
+	}{
+		{name: "exporter", wantGroup: "exporter"},
+		{name: "exporter[PG=12]", wantGroup: "exporter", wantCell: []string{"PG=12"}},
+		{name: "exporter[PG=12;EXPORTER=v1]", wantGroup: "exporter", wantCell: []string{"PG=12", "EXPORTER=v1"}},
+		{name: "[PG=12]", wantGroup: "[PG=12]"},
+		{name: "exporter[PG=12", wantGroup: "exporter[PG=12"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			group, cell := ParseMatrixGroup(c.name)
+			if group != c.wantGroup || !reflect.DeepEqual(cell, c.wantCell) {
+				t.Errorf("got %q %v, want %q %v", group, cell, c.wantGroup, c.wantCell)
+			}
+		})
+	}
+}
+
+func TestMatrixGroupRoundTrip(t *testing.T) {
+	cells := [][]string{nil, {"PG=12"}, {"PG=12", "EXPORTER=v1"}}
+	for _, cell := range cells {
+		name := MatrixGroup("exporter", cell)
+		group, parsed := ParseMatrixGroup(name)
+		if group != "exporter" || !reflect.DeepEqual(parsed, cell) {
+			t.Errorf("%s parsed as %q %v", name, group, parsed)
+		}
+	}
+}
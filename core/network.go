@@ -0,0 +1,293 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/mrlyc/heracles/log"
+	"github.com/rotisserie/eris"
+)
+
+// NetworkFaultConfig degrades the network of a compose service. The image of a netem fault provides
+// tc, it is better pinned by digest.
+type NetworkFaultConfig struct {
+	Service   string        `mapstructure:"service"`
+	Fault     string        `mapstructure:"fault"`
+	Network   string        `mapstructure:"network"`
+	Delay     time.Duration `mapstructure:"delay"`
+	Jitter    time.Duration `mapstructure:"jitter"`
+	Loss      float64       `mapstructure:"loss"`
+	Interface string        `mapstructure:"interface"`
+	Image     string        `mapstructure:"image"`
+	Remove    bool          `mapstructure:"remove"`
+}
+
+// NetworkFaultFixture injects a network fault into a compose service on setup and removes it on tear down.
+//
+// A `partition` fault disconnects the service from its compose networks, or only from the given one.
+// A `netem` fault adds latency and packet loss to the service's interface with tc-netem, run in a
+// sidecar container sharing the service's network namespace, so the service image needs no tools.
+// With remove set, the fixture removes a fault injected by an earlier step instead.
+type NetworkFaultFixture struct {
+	dockerCompose *DockerCompose
+	Service       string
+	Fault         string
+	Network       string
+	Delay         time.Duration
+	Jitter        time.Duration
+	Loss          float64
+	Interface     string
+	Image         string
+	Remove        bool
+
+	// endpoints keeps the settings of the disconnected networks to reconnect them
+	endpoints map[string]*network.EndpointSettings
+}
+
+func (n *NetworkFaultFixture) String() string {
+	return fmt.Sprintf("NetworkFaultFixture{Service: %s, Fault: %s, Remove: %v}", n.Service, n.Fault, n.Remove)
+}
+
+func (n *NetworkFaultFixture) matchNetwork(name string) bool {
+	return n.Network == "" || name == n.Network || name == n.dockerCompose.ProjectName+"_"+n.Network
+}
+
+func (n *NetworkFaultFixture) disconnect(ctx context.Context, dockerClient client.APIClient, id string) error {
+	inspect, err := dockerClient.ContainerInspect(ctx, id)
+	if err != nil {
+		return eris.Wrapf(err, "failed to inspect service: %s", n.Service)
+	}
+
+	n.endpoints = make(map[string]*network.EndpointSettings)
+	for name, endpoint := range inspect.NetworkSettings.Networks {
+		if !n.matchNetwork(name) {
+			continue
+		}
+
+		log.FromContext(ctx).Infof("disconnecting service %s from network %s", n.Service, name)
+		err := dockerClient.NetworkDisconnect(ctx, name, id, true)
+		if err != nil {
+			return eris.Wrapf(err, "failed to disconnect service %s from network %s", n.Service, name)
+		}
+
+		n.endpoints[name] = &network.EndpointSettings{
+			Aliases: endpoint.Aliases,
+			Links:   endpoint.Links,
+		}
+	}
+
+	if len(n.endpoints) == 0 {
+		return eris.Errorf("no network of service %s matches: %s", n.Service, n.Network)
+	}
+
+	return nil
+}
+
+func (n *NetworkFaultFixture) reconnect(ctx context.Context, dockerClient client.APIClient, id string) error {
+	inspect, err := dockerClient.ContainerInspect(ctx, id)
+	if err != nil {
+		return eris.Wrapf(err, "failed to inspect service: %s", n.Service)
+	}
+
+	endpoints := n.endpoints
+	if endpoints == nil {
+		// the fault was injected by another fixture, reconnect to the networks of the compose project
+		networks, err := dockerClient.NetworkList(ctx, types.NetworkListOptions{})
+		if err != nil {
+			return eris.Wrap(err, "failed to list networks")
+		}
+
+		endpoints = make(map[string]*network.EndpointSettings)
+		for _, item := range networks {
+			if item.Labels["com.docker.compose.project"] == n.dockerCompose.ProjectName && n.matchNetwork(item.Name) {
+				endpoints[item.Name] = &network.EndpointSettings{Aliases: []string{n.Service}}
+			}
+		}
+	}
+
+	for name, endpoint := range endpoints {
+		if _, ok := inspect.NetworkSettings.Networks[name]; ok {
+			continue
+		}
+
+		log.FromContext(ctx).Infof("reconnecting service %s to network %s", n.Service, name)
+		err := dockerClient.NetworkConnect(ctx, name, id, endpoint)
+		if err != nil {
+			return eris.Wrapf(err, "failed to connect service %s to network %s", n.Service, name)
+		}
+	}
+
+	return nil
+}
+
+func (n *NetworkFaultFixture) netemArgs() []string {
+	args := []string{"qdisc", "replace", "dev", n.Interface, "root", "netem"}
+	if n.Delay > 0 {
+		args = append(args, "delay", fmt.Sprintf("%dus", n.Delay.Microseconds()))
+		if n.Jitter > 0 {
+			args = append(args, fmt.Sprintf("%dus", n.Jitter.Microseconds()))
+		}
+	}
+	if n.Loss > 0 {
+		args = append(args, "loss", fmt.Sprintf("%g%%", n.Loss))
+	}
+	return args
+}
+
+// runSidecar runs tc in a container sharing the network namespace of the service.
+func (n *NetworkFaultFixture) runSidecar(ctx context.Context, dockerClient client.APIClient, id string, args []string) error {
+	_, _, err := dockerClient.ImageInspectWithRaw(ctx, n.Image)
+	if client.IsErrNotFound(err) {
+		reader, err := dockerClient.ImagePull(ctx, n.Image, types.ImagePullOptions{})
+		if err != nil {
+			return eris.Wrapf(err, "failed to pull image: %s", n.Image)
+		}
+		_, _ = io.Copy(io.Discard, reader)
+		_ = reader.Close()
+	} else if err != nil {
+		return eris.Wrapf(err, "failed to inspect image: %s", n.Image)
+	}
+
+	created, err := dockerClient.ContainerCreate(
+		ctx,
+		&container.Config{
+			Image:      n.Image,
+			Entrypoint: []string{"tc"},
+			Cmd:        args,
+		},
+		&container.HostConfig{
+			NetworkMode: container.NetworkMode("container:" + id),
+			CapAdd:      []string{"NET_ADMIN"},
+		},
+		nil, nil, "",
+	)
+	if err != nil {
+		return eris.Wrap(err, "failed to create tc container")
+	}
+	defer func() {
+		_ = dockerClient.ContainerRemove(ctx, created.ID, container.RemoveOptions{Force: true})
+	}()
+
+	err = dockerClient.ContainerStart(ctx, created.ID, container.StartOptions{})
+	if err != nil {
+		return eris.Wrap(err, "failed to start tc container")
+	}
+
+	statusCh, errCh := dockerClient.ContainerWait(ctx, created.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return eris.Wrap(err, "failed to wait for tc container")
+	case status := <-statusCh:
+		if status.StatusCode != 0 {
+			return eris.Errorf("failed to run tc %s, code: %d", strings.Join(args, " "), status.StatusCode)
+		}
+	}
+
+	return nil
+}
+
+func (n *NetworkFaultFixture) inject(ctx context.Context) error {
+	serviceContainer, err := n.dockerCompose.ServiceContainer(ctx, n.Service)
+	if err != nil {
+		return eris.Wrapf(err, "failed to get container of service: %s", n.Service)
+	}
+
+	dockerClient, err := n.dockerCompose.DockerClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	id := serviceContainer.GetContainerID()
+	switch n.Fault {
+	case "partition":
+		return n.disconnect(ctx, dockerClient, id)
+	default:
+		log.FromContext(ctx).Infof("adding netem to service %s: %s", n.Service, strings.Join(n.netemArgs(), " "))
+		return n.runSidecar(ctx, dockerClient, id, n.netemArgs())
+	}
+}
+
+// heal removes the fault, a missing netem is only an error when removed explicitly by a step, as a
+// later step may have removed it before the fixture is torn down.
+func (n *NetworkFaultFixture) heal(ctx context.Context, explicit bool) error {
+	serviceContainer, err := n.dockerCompose.ServiceContainer(ctx, n.Service)
+	if err != nil {
+		return eris.Wrapf(err, "failed to get container of service: %s", n.Service)
+	}
+
+	dockerClient, err := n.dockerCompose.DockerClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	id := serviceContainer.GetContainerID()
+	switch n.Fault {
+	case "partition":
+		return n.reconnect(ctx, dockerClient, id)
+	default:
+		log.FromContext(ctx).Infof("removing netem from service %s", n.Service)
+		err := n.runSidecar(ctx, dockerClient, id, []string{"qdisc", "del", "dev", n.Interface, "root"})
+		if err != nil && explicit {
+			return eris.Wrapf(err, "failed to remove netem from service %s", n.Service)
+		} else if err != nil {
+			log.FromContext(ctx).Debugf("failed to remove netem from service %s: %v", n.Service, err)
+		}
+		return nil
+	}
+}
+
+func (n *NetworkFaultFixture) Setup(ctx context.Context) error {
+	if n.Remove {
+		return n.heal(ctx, true)
+	}
+	return n.inject(ctx)
+}
+
+func (n *NetworkFaultFixture) TearDown(ctx context.Context) error {
+	if n.Remove {
+		return nil
+	}
+	return n.heal(ctx, false)
+}
+
+func NewNetworkFaultFixture(dockerCompose *DockerCompose, config NetworkFaultConfig) (*NetworkFaultFixture, error) {
+	switch config.Fault {
+	case "partition":
+	case "netem":
+		if !config.Remove && config.Delay <= 0 && config.Loss <= 0 {
+			return nil, eris.Errorf("netem fault of service %s needs a delay or a loss", config.Service)
+		}
+		if !config.Remove && config.Jitter > 0 && config.Delay <= 0 {
+			return nil, eris.Errorf("netem fault of service %s needs a delay for the jitter", config.Service)
+		}
+		if config.Image == "" {
+			return nil, eris.Errorf("netem fault of service %s needs an image providing tc", config.Service)
+		}
+	default:
+		return nil, eris.Errorf("unknown network fault %q of service: %s", config.Fault, config.Service)
+	}
+
+	if config.Interface == "" {
+		config.Interface = "eth0"
+	}
+
+	return &NetworkFaultFixture{
+		dockerCompose: dockerCompose,
+		Service:       config.Service,
+		Fault:         config.Fault,
+		Network:       config.Network,
+		Delay:         config.Delay,
+		Jitter:        config.Jitter,
+		Loss:          config.Loss,
+		Interface:     config.Interface,
+		Image:         config.Image,
+		Remove:        config.Remove,
+	}, nil
+}
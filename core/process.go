@@ -0,0 +1,262 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mrlyc/heracles/log"
+	"github.com/rotisserie/eris"
+)
+
+// ProcessConfig launches the exporter as a local process, like a binary just built by `go build`.
+type ProcessConfig struct {
+	Name         string        `mapstructure:"name"`
+	Command      string        `mapstructure:"command"`
+	Args         []string      `mapstructure:"args"`
+	Env          []string      `mapstructure:"env"`
+	Dir          string        `mapstructure:"dir"`
+	ReadyTimeout time.Duration `mapstructure:"ready_timeout"`
+	StopTimeout  time.Duration `mapstructure:"stop_timeout"`
+	DependsOn    []string      `mapstructure:"depends_on"`
+}
+
+// ParseEnv parses environment variables like KEY=VALUE. They are listed rather than mapped in
+// configs, where the keys of maps are case-insensitive.
+func ParseEnv(items []string) (map[string]string, error) {
+	env := make(map[string]string, len(items))
+	for _, item := range items {
+		key, value, found := strings.Cut(item, "=")
+		if !found || key == "" {
+			return nil, eris.Errorf("invalid environment variable, KEY=VALUE expected: %s", item)
+		}
+		env[key] = value
+	}
+
+	return env, nil
+}
+
+// lockedBuffer is a buffer written by the output copying goroutines of a process.
+type lockedBuffer struct {
+	lock   sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buffer.String()
+}
+
+// ProcessExporter is an exporter running as a local process. As a fixture it starts the process
+// and waits until the metrics path answers, then kills the process when it is torn down.
+type ProcessExporter struct {
+	config     ProcessConfig
+	endpoint   string
+	metricPath string
+	httpClient HTTPClient
+
+	cmd     *exec.Cmd
+	output  *lockedBuffer
+	exited  chan struct{}
+	waitErr error
+}
+
+func (e *ProcessExporter) String() string {
+	return fmt.Sprintf("ProcessExporter{Command: %s, Args: %v, Endpoint: %s}", e.config.Command, e.config.Args, e.endpoint)
+}
+
+func (e *ProcessExporter) GetName() string {
+	return e.config.Name
+}
+
+func (e *ProcessExporter) DependsOn() []string {
+	return e.config.DependsOn
+}
+
+// AlwaysTearDown kills the process even if it did not become ready.
+func (e *ProcessExporter) AlwaysTearDown() bool {
+	return true
+}
+
+// ServiceLogs returns the stdout and stderr of the process whatever the service is, so the
+// exporter logs can be checked.
+func (e *ProcessExporter) ServiceLogs(ctx context.Context, service string) (string, error) {
+	if e.output == nil {
+		return "", eris.Errorf("process of %s not started", e.config.Name)
+	}
+	return e.output.String(), nil
+}
+
+func (e *ProcessExporter) Setup(ctx context.Context) error {
+	e.output = &lockedBuffer{}
+	e.exited = make(chan struct{})
+	e.waitErr = nil
+
+	// not bound to the context, the process is killed when torn down, along with its children like
+	// the binary of `go run` as it leads a process group
+	e.cmd = exec.Command(e.config.Command, e.config.Args...)
+	e.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	e.cmd.Dir = e.config.Dir
+	e.cmd.Env = append(os.Environ(), e.config.Env...)
+	e.cmd.Stdout = e.output
+	e.cmd.Stderr = e.output
+
+	log.FromContext(ctx).Infof("starting exporter process: %s %v", e.config.Command, e.config.Args)
+	err := e.cmd.Start()
+	if err != nil {
+		e.cmd = nil
+		return eris.Wrapf(err, "failed to start exporter process: %s", e.config.Command)
+	}
+
+	go func(cmd *exec.Cmd, exited chan struct{}) {
+		e.waitErr = cmd.Wait()
+		close(exited)
+	}(e.cmd, e.exited)
+
+	return e.waitReady(ctx)
+}
+
+// waitReady polls the metrics path until it answers, the process exits or the ready timeout passes.
+func (e *ProcessExporter) waitReady(ctx context.Context) error {
+	timeout := e.config.ReadyTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	url, err := url.JoinPath(e.endpoint, e.metricPath)
+	if err != nil {
+		return eris.Wrap(err, "failed to join url")
+	}
+
+	for {
+		resp, err := e.httpClient.Get(url)
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				log.FromContext(ctx).Infof("exporter process ready: %s", url)
+				return nil
+			}
+			err = eris.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+		log.FromContext(ctx).Debugf("exporter process not ready: %v", err)
+
+		select {
+		case <-e.exited:
+			return eris.Errorf("exporter process exited before ready: %v, output:\n%s", e.waitErr, e.output.String())
+		case <-ctx.Done():
+			return eris.Wrapf(err, "exporter process not ready within %s", timeout)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// TearDown stops the process with SIGTERM, then kills it after the stop timeout.
+func (e *ProcessExporter) TearDown(ctx context.Context) error {
+	if e.cmd == nil {
+		return nil
+	}
+	defer func() { e.cmd = nil }()
+
+	select {
+	case <-e.exited:
+		log.FromContext(ctx).Warnf("exporter process already exited: %v", e.waitErr)
+		return nil
+	default:
+	}
+
+	timeout := e.config.StopTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	// signals the process group
+	err := syscall.Kill(-e.cmd.Process.Pid, syscall.SIGTERM)
+	if err == nil {
+		select {
+		case <-e.exited:
+			return nil
+		case <-ctx.Done():
+		case <-time.After(timeout):
+		}
+		log.FromContext(ctx).Warnf("exporter process not stopped within %s, killing it", timeout)
+	}
+
+	err = syscall.Kill(-e.cmd.Process.Pid, syscall.SIGKILL)
+	if err != nil {
+		return eris.Wrap(err, "failed to kill exporter process")
+	}
+	<-e.exited
+
+	return nil
+}
+
+// Pid returns the id of the running process, which leads its process group, or 0.
+func (e *ProcessExporter) Pid() int {
+	if e.cmd == nil || e.cmd.Process == nil {
+		return 0
+	}
+
+	select {
+	case <-e.exited:
+		return 0
+	default:
+		return e.cmd.Process.Pid
+	}
+}
+
+// Start returns the endpoint, the process is started as a fixture.
+func (e *ProcessExporter) Start(ctx context.Context) (string, error) {
+	if e.cmd == nil {
+		return "", eris.New("exporter process not started")
+	}
+
+	select {
+	case <-e.exited:
+		return "", eris.Errorf("exporter process exited: %v, output:\n%s", e.waitErr, e.output.String())
+	default:
+	}
+
+	return e.endpoint, nil
+}
+
+func NewProcessExporter(config ProcessConfig, exporterHost string, exporterPort string, metricPath string) (*ProcessExporter, error) {
+	if config.Command == "" {
+		return nil, eris.New("command of exporter process is required")
+	}
+
+	_, err := ParseEnv(config.Env)
+	if err != nil {
+		return nil, eris.Wrap(err, "invalid env of exporter process")
+	}
+
+	if config.Name == "" {
+		config.Name = "exporter"
+	}
+
+	return &ProcessExporter{
+		config:     config,
+		endpoint:   fmt.Sprintf("http://%s:%s", exporterHost, exporterPort),
+		metricPath: metricPath,
+		httpClient: &http.Client{Timeout: time.Second},
+	}, nil
+}
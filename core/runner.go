@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 	"net/url"
+	"os"
 	"time"
 
 	"github.com/mrlyc/heracles/log"
@@ -16,58 +17,266 @@ import (
 
 var ErrCheck = errors.New("check failed")
 
+// ErrTeardown is returned by a run whose fixtures failed to tear down, if it fails on teardown errors.
+var ErrTeardown = errors.New("teardown failed")
+
+// Sleep waits for the duration, or returns early when the context is done.
+func Sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return eris.Wrap(ctx.Err(), "interrupted while waiting")
+	case <-timer.C:
+		return nil
+	}
+}
+
 type CheckReport struct {
+	Success   bool                         `json:"success"`
+	Metrics   map[string]*dto.MetricFamily `json:"inputs"`
+	Results   map[string]string            `json:"outputs"`
+	Steps     []*StepReport                `json:"steps,omitempty" yaml:"steps,omitempty"`
+	Fixtures  []*FixtureReport             `json:"fixtures,omitempty" yaml:"fixtures,omitempty"`
+	Vars      map[string]string            `json:"vars,omitempty" yaml:"vars,omitempty"`
+	Setup     []*FixtureStatus             `json:"setup,omitempty" yaml:"setup,omitempty"`
+	OnFailure []*FixtureReport             `json:"on_failure,omitempty" yaml:"on_failure,omitempty"`
+	Teardown  []*FixtureStatus             `json:"teardown,omitempty" yaml:"teardown,omitempty"`
+	Artifacts map[string]string            `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
+}
+
+// StepReport is the outcome of a scenario step.
+type StepReport struct {
+	Name    string                       `json:"name"`
 	Success bool                         `json:"success"`
-	Metrics map[string]*dto.MetricFamily `json:"inputs"`
-	Results map[string]string            `json:"outputs"`
+	Metrics map[string]*dto.MetricFamily `json:"inputs,omitempty" yaml:"metrics,omitempty"`
+	Results map[string]string            `json:"outputs,omitempty" yaml:"results,omitempty"`
 }
 
 func (c *CheckReport) Yaml() ([]byte, error) {
 	return yaml.Marshal(c)
 }
 
+// SuiteReport aggregates the check reports of several config groups.
+type SuiteReport struct {
+	Success bool                     `yaml:"success"`
+	Groups  map[string]*CheckReport  `yaml:"groups"`
+	Errors  map[string]string        `yaml:"errors,omitempty"`
+	Matrix  map[string]*MatrixReport `yaml:"matrix,omitempty"`
+}
+
+// Add records the outcome of a group, errors other than ErrCheck and ErrTeardown are kept as crash messages.
+// The cells of the matrix of a group are also summarized under the group.
+func (s *SuiteReport) Add(group string, report *CheckReport, err error) {
+	s.Groups[group] = report
+
+	matrixGroup, cell := ParseMatrixGroup(group)
+	if len(cell) != 0 {
+		matrix, ok := s.Matrix[matrixGroup]
+		if !ok {
+			matrix = &MatrixReport{}
+			s.Matrix[matrixGroup] = matrix
+		}
+		matrix.Add(group, cell, err)
+	}
+
+	if err == nil {
+		return
+	}
+
+	s.Success = false
+	switch eris.Cause(err) {
+	case ErrCheck, ErrTeardown:
+		// the report of the group tells the failed checks and fixtures
+	default:
+		s.Errors[group] = err.Error()
+	}
+}
+
+func (s *SuiteReport) Yaml() ([]byte, error) {
+	return yaml.Marshal(s)
+}
+
+func NewSuiteReport() *SuiteReport {
+	return &SuiteReport{
+		Success: true,
+		Groups:  make(map[string]*CheckReport),
+		Errors:  make(map[string]string),
+		Matrix:  make(map[string]*MatrixReport),
+	}
+}
+
+// ReadCheckReport loads a report previously written by the check command. The report of several
+// groups is a suite report, from which the report of the given group is loaded.
+func ReadCheckReport(path string, group string) (*CheckReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to read check report: %s", path)
+	}
+
+	var suite struct {
+		Groups map[string]*CheckReport `yaml:"groups"`
+	}
+	err = yaml.Unmarshal(data, &suite)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to parse check report: %s", path)
+	}
+
+	var report *CheckReport
+	switch {
+	case suite.Groups != nil && group == "":
+		return nil, eris.Errorf("check report of several groups, select one like %s#<group>: %s", path, path)
+	case suite.Groups != nil:
+		report = suite.Groups[group]
+		if report == nil {
+			return nil, eris.Errorf("no report of group %s in check report: %s", group, path)
+		}
+	case group != "":
+		return nil, eris.Errorf("check report of a single group, no group can be selected: %s", path)
+	default:
+		report = &CheckReport{}
+		err = yaml.Unmarshal(data, report)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to parse check report: %s", path)
+		}
+	}
+
+	if report.Metrics == nil {
+		return nil, eris.Errorf("no metrics in check report: %s", path)
+	}
+
+	return report, nil
+}
+
 type MetricSample struct {
-	Labels map[string]string `json:"labels,omitempty"`
-	Value  *float64          `json:"value"`
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Value  *float64          `json:"value" yaml:"value,omitempty"`
+	// ValueFrom names a hook output as the expected value
+	ValueFrom string `json:"value_from,omitempty" mapstructure:"value_from" yaml:"value_from,omitempty"`
 }
 
 type MetricsConfig struct {
-	Name             string         `mapstructure:"name"`
-	Type             string         `mapstructure:"type"`
-	Labels           []string       `mapstructure:"labels"`
-	DisallowedLabels []string       `mapstructure:"disallowed_labels"`
-	Samples          []MetricSample `mapstructure:"samples"`
+	Name             string         `mapstructure:"name" yaml:"name"`
+	Type             string         `mapstructure:"type" yaml:"type,omitempty"`
+	Labels           []string       `mapstructure:"labels" yaml:"labels,omitempty"`
+	DisallowedLabels []string       `mapstructure:"disallowed_labels" yaml:"disallowed_labels,omitempty"`
+	Samples          []MetricSample `mapstructure:"samples" yaml:"samples,omitempty"`
 }
 
+// TeardownPolicy tells when the fixtures of a run are torn down.
+type TeardownPolicy int
+
+const (
+	TeardownAlways TeardownPolicy = iota
+	// TeardownOnSuccess keeps the fixtures of a failed run for debugging.
+	TeardownOnSuccess
+	TeardownNever
+)
+
 type Runner struct {
 	exporter     Exporter
 	fixtures     []Fixture
 	httpClient   HTTPClient
 	metricPath   string
 	waitDuration time.Duration
+	teardown     TeardownPolicy
+	// teardownTimeout limits the teardown, which runs even if the context of the run is cancelled
+	teardownTimeout     time.Duration
+	failOnTeardownError bool
+	// onFailure runs when the run fails, before tearing down
+	onFailure []Fixture
+
+	// baseUrl, setups, the statuses and kept describe the current run
+	baseUrl          string
+	setupStatuses    []*FixtureStatus
+	teardownStatuses []*FixtureStatus
+	setups           []Fixture
+	kept             bool
 }
 
-func (r *Runner) SetupFixtures(ctx context.Context) ([]Fixture, error) {
-	setups := make([]Fixture, 0, len(r.fixtures))
-	for _, fixture := range r.fixtures {
-		log.Debugf("setting up fixture: %s", fixture)
-		if err := fixture.Setup(ctx); err != nil {
-			return setups, eris.Wrap(err, "failed to setup fixture")
+func (r *Runner) SetTeardownPolicy(policy TeardownPolicy) {
+	r.teardown = policy
+}
+
+func (r *Runner) SetTeardownTimeout(timeout time.Duration) {
+	r.teardownTimeout = timeout
+}
+
+// SetFailOnTeardownError makes a run fail with ErrTeardown if a fixture fails to tear down.
+func (r *Runner) SetFailOnTeardownError(fail bool) {
+	r.failOnTeardownError = fail
+}
+
+// SetOnFailureFixtures sets the fixtures run when a run fails, like hooks dumping diagnostics.
+func (r *Runner) SetOnFailureFixtures(fixtures []Fixture) {
+	r.onFailure = fixtures
+}
+
+// runOnFailure sets up and tears down the on failure fixtures, their errors are only logged.
+func (r *Runner) runOnFailure(ctx context.Context) {
+	for _, fixture := range r.onFailure {
+		log.FromContext(ctx).Infof("running on failure fixture: %s", fixtureName(fixture))
+		err := fixture.Setup(ctx)
+		if err != nil {
+			log.FromContext(ctx).Errorf("failed to run on failure fixture %s: %v", fixtureName(fixture), err)
 		}
-		setups = append(setups, fixture)
+
+		err = fixture.TearDown(ctx)
+		if err != nil {
+			log.FromContext(ctx).Errorf("failed to tear down on failure fixture %s: %v", fixtureName(fixture), err)
+		}
+	}
+}
+
+// teardownContext returns a context for tearing down the fixtures of a run, it keeps the values
+// of the run's context but not its cancellation, so that an interrupted run still cleans up.
+func (r *Runner) teardownContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = context.WithoutCancel(ctx)
+	if r.teardownTimeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, r.teardownTimeout)
+}
+
+// BaseUrl returns the endpoint of the exporter started by the last run.
+func (r *Runner) BaseUrl() string {
+	return r.baseUrl
+}
+
+// Kept tells whether the fixtures of the last run were kept instead of torn down.
+func (r *Runner) Kept() bool {
+	return r.kept
+}
+
+// SetupFixtures sets up the fixtures following their dependencies, it returns the fixtures set up.
+func (r *Runner) SetupFixtures(ctx context.Context) ([]Fixture, error) {
+	setups, statuses, err := setupFixtureGraph(ctx, r.fixtures)
+	r.setupStatuses = statuses
+	return setups, err
+}
 
-	return setups, nil
+// SetupStatuses returns the outcome of setting up each fixture in the last run.
+func (r *Runner) SetupStatuses() []*FixtureStatus {
+	return r.setupStatuses
 }
 
+// TearDownFixtures tears down the fixtures in reverse, it records the outcome of each fixture and
+// tells whether all of them were torn down.
 func (r *Runner) TearDownFixtures(ctx context.Context, fixtures []Fixture) (ok bool) {
 	ok = true
+	r.teardownStatuses = make([]*FixtureStatus, 0, len(fixtures))
 
 	for i := len(fixtures) - 1; i >= 0; i-- {
-		log.Debugf("tearing down fixture: %s", r.fixtures[i])
+		status := &FixtureStatus{Fixture: fixtureName(fixtures[i]), Status: FixtureStatusOk}
+		r.teardownStatuses = append(r.teardownStatuses, status)
+
+		log.FromContext(ctx).Debugf("tearing down fixture: %s", fixtures[i])
 		err := fixtures[i].TearDown(ctx)
 		if err != nil {
-			log.Errorf("failed to tear down fixtures: %+v", err)
+			log.FromContext(ctx).Errorf("failed to tear down fixture %s: %+v", status.Fixture, err)
+			status.Status = FixtureStatusFailed
+			status.Error = err.Error()
 			ok = false
 		}
 	}
@@ -75,18 +284,28 @@ func (r *Runner) TearDownFixtures(ctx context.Context, fixtures []Fixture) (ok b
 	return ok
 }
 
+// TeardownStatuses returns the outcome of tearing down each fixture in the last run, in the teardown order.
+func (r *Runner) TeardownStatuses() []*FixtureStatus {
+	return r.teardownStatuses
+}
+
 func (r *Runner) FetchMetricFamilies(ctx context.Context, baseUrl string) (map[string]*dto.MetricFamily, error) {
 	url, err := url.JoinPath(baseUrl, r.metricPath)
 	if err != nil {
 		return nil, eris.Wrap(err, "failed to join url")
 	}
 
-	resp, err := r.httpClient.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to create request")
+	}
+
+	resp, err := r.httpClient.Do(req)
 	if err != nil {
 		return nil, eris.Wrap(err, "failed to fetch metrics")
 	}
 
-	log.Infof("fetch metrics from %s, status code: %d", url, resp.StatusCode)
+	log.FromContext(ctx).Infof("fetch metrics from %s, status code: %d", url, resp.StatusCode)
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, eris.New("failed to fetch metrics: " + resp.Status)
@@ -100,40 +319,90 @@ func (r *Runner) FetchMetricFamilies(ctx context.Context, baseUrl string) (map[s
 		return nil, eris.Wrap(err, "failed to parse metrics")
 	}
 
-	log.Infof("found %d metrics", len(metricFamily))
+	log.FromContext(ctx).Infof("found %d metrics", len(metricFamily))
 
 	return metricFamily, nil
 }
 
-func (r *Runner) Run(ctx context.Context, callback func(ctx context.Context, metricFamilies map[string]*dto.MetricFamily) error) error {
-	fixtures, err := r.SetupFixtures(ctx)
+// RunFixtures sets up the fixtures, calls the callback and tears the fixtures down.
+func (r *Runner) RunFixtures(ctx context.Context, callback func(ctx context.Context) error) (err error) {
+	r.kept = false
+	r.teardownStatuses = nil
+	r.setups, err = r.SetupFixtures(ctx)
 	defer func() {
-		r.TearDownFixtures(ctx, fixtures)
+		if err != nil && len(r.onFailure) != 0 {
+			failureCtx, cancel := r.teardownContext(ctx)
+			r.runOnFailure(failureCtx)
+			cancel()
+		}
+
+		// an interrupted run is not a failure to investigate, its fixtures are torn down
+		if r.teardown == TeardownNever || (r.teardown == TeardownOnSuccess && err != nil && ctx.Err() == nil) {
+			log.FromContext(ctx).Warnf("keeping %d fixtures", len(r.setups))
+			r.kept = true
+		} else {
+			teardownCtx, cancel := r.teardownContext(ctx)
+			ok := r.TearDownFixtures(teardownCtx, r.setups)
+			cancel()
+
+			if !ok && r.failOnTeardownError && err == nil {
+				err = ErrTeardown
+			}
+		}
+		r.setups = nil
 	}()
 
 	if err != nil {
 		return err
 	}
 
-	baseUrl, err := r.exporter.Start(ctx)
-	if err != nil {
-		return eris.Wrap(err, "failed to start exporter")
-	}
+	err = callback(ctx)
+	return err
+}
 
-	log.Infof("waiting for %s", r.waitDuration)
-	time.Sleep(r.waitDuration)
+// SetupRunFixtures sets up fixtures in the middle of a run, they are torn down along with the fixtures of the run.
+func (r *Runner) SetupRunFixtures(ctx context.Context, fixtures []Fixture) error {
+	setups, _, err := setupFixtureGraph(ctx, fixtures)
+	r.setups = append(r.setups, setups...)
+	return err
+}
 
-	metricFamilies, err := r.FetchMetricFamilies(ctx, baseUrl)
+// Scrape fetches the metric families from the exporter started by the current run.
+func (r *Runner) Scrape(ctx context.Context) (map[string]*dto.MetricFamily, error) {
+	metricFamilies, err := r.FetchMetricFamilies(ctx, r.baseUrl)
 	if err != nil {
-		return eris.Wrap(err, "failed to fetch metrics")
+		return nil, eris.Wrap(err, "failed to fetch metrics")
 	}
 
-	err = callback(ctx, metricFamilies)
-	if err != nil {
-		return err
-	}
+	return metricFamilies, nil
+}
+
+func (r *Runner) Run(ctx context.Context, callback func(ctx context.Context, metricFamilies map[string]*dto.MetricFamily) error) error {
+	return r.RunFixtures(ctx, func(ctx context.Context) error {
+		var err error
+		r.baseUrl, err = r.exporter.Start(ctx)
+		if err != nil {
+			return eris.Wrap(err, "failed to start exporter")
+		}
+
+		log.FromContext(ctx).Infof("waiting for %s", r.waitDuration)
+		err = Sleep(ctx, r.waitDuration)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		metricFamilies, err := r.Scrape(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = callback(ctx, metricFamilies)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
 }
 
 func NewRunner(exporter Exporter, fixtures []Fixture, metricPath string, waitDuration time.Duration) *Runner {
@@ -151,14 +420,54 @@ type MetricChecker struct {
 	disallowedMetrics []string
 	allowEmpty        bool
 	metrics           []MetricsConfig
+	steps             []*Step
+	vars              *HookVars
+	logSource         LogSource
+	logService        string
+	logsCheckers      []LogsChecker
 }
 
-func (c *MetricChecker) CheckMetrics(ctx context.Context, metricFamily map[string]*dto.MetricFamily) (*CheckReport, error) {
-	checkers, err := c.BuildChecker()
+// SetLogsCheckers sets the checkers of the logs of a service, like the exporter.
+func (c *MetricChecker) SetLogsCheckers(source LogSource, service string, checkers []LogsChecker) {
+	c.logSource = source
+	c.logService = service
+	c.logsCheckers = checkers
+}
+
+// CheckLogs checks the logs of the service, the results are added to the report.
+func (c *MetricChecker) CheckLogs(ctx context.Context, report *CheckReport) error {
+	if len(c.logsCheckers) == 0 {
+		return nil
+	}
+
+	logs, err := c.logSource.ServiceLogs(ctx, c.logService)
 	if err != nil {
-		return nil, eris.Wrap(err, "failed to build checkers")
+		return eris.Wrap(err, "failed to check logs")
+	}
+
+	var returnedError error
+	for _, checker := range c.logsCheckers {
+		log.FromContext(ctx).Debugf("checking logs of service %s by checker %v", c.logService, checker)
+		ok, message := checker.Check(logs)
+		if !ok {
+			log.FromContext(ctx).Errorf("logs check failed, %v", message)
+			report.Success = false
+			returnedError = ErrCheck
+		}
+
+		report.Results[checker.String()] = message
 	}
 
+	return returnedError
+}
+
+// SetHookVars sets the outputs of hooks which the samples assert with value_from.
+func (c *MetricChecker) SetHookVars(vars *HookVars) {
+	c.vars = vars
+}
+
+// runCheckers checks the metric families with every checker and reports the results.
+func runCheckers(ctx context.Context, checkers []MetricFamiliesChecker, metricFamily map[string]*dto.MetricFamily) (*CheckReport, error) {
 	var returnedError error
 	report := &CheckReport{
 		Success: true,
@@ -167,10 +476,11 @@ func (c *MetricChecker) CheckMetrics(ctx context.Context, metricFamily map[strin
 	}
 
 	for _, checker := range checkers {
-		log.Debugf("checking metrics by checker %v", checker)
+		log.FromContext(ctx).Debugf("checking metrics by checker %v", checker)
 		ok, message := checker.Check(metricFamily)
 		if !ok {
-			log.Errorf("metrics check failed, %v", message)
+			log.FromContext(ctx).Errorf("metrics check failed, %v", message)
+			report.Success = false
 			returnedError = ErrCheck
 		}
 
@@ -180,19 +490,20 @@ func (c *MetricChecker) CheckMetrics(ctx context.Context, metricFamily map[strin
 	return report, returnedError
 }
 
-func (c *MetricChecker) BuildChecker() ([]MetricFamiliesChecker, error) {
+// buildCheckers builds the checkers for a set of metric assertions, the hook outputs are
+// resolved now so that the values are the ones of the hooks which ran before.
+func buildCheckers(disallowedMetrics []string, allowEmpty bool, metrics []MetricsConfig, vars *HookVars) ([]MetricFamiliesChecker, error) {
 	checkerBuilder := NewMetricFamiliesCheckerBuilder()
 
-	disallowedMetrics := c.disallowedMetrics
 	if len(disallowedMetrics) != 0 {
 		checkerBuilder.DisallowedMetrics(disallowedMetrics)
 	}
 
-	if !c.allowEmpty {
+	if !allowEmpty {
 		checkerBuilder.EmptyMetricsChecker()
 	}
 
-	for _, metric := range c.metrics {
+	for _, metric := range metrics {
 		checkerBuilder.MetricExistsChecker(metric.Name)
 
 		if metric.Type != "" {
@@ -213,16 +524,179 @@ func (c *MetricChecker) BuildChecker() ([]MetricFamiliesChecker, error) {
 			if sample.Value != nil {
 				checkerBuilder.MetricSampleValueChecker(metric.Name, sample.Labels, *sample.Value)
 			}
+
+			if sample.ValueFrom != "" {
+				value, err := vars.Float(sample.ValueFrom)
+				if err != nil {
+					return nil, eris.Wrapf(err, "invalid sample of metric: %s", metric.Name)
+				}
+				checkerBuilder.MetricSampleValueChecker(metric.Name, sample.Labels, value)
+			}
 		}
 	}
 
 	return checkerBuilder.Build(), nil
 }
 
+func (c *MetricChecker) CheckMetrics(ctx context.Context, metricFamily map[string]*dto.MetricFamily) (*CheckReport, error) {
+	checkers, err := c.BuildChecker()
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to build checkers")
+	}
+
+	return runCheckers(ctx, checkers, metricFamily)
+}
+
+func (c *MetricChecker) BuildChecker() ([]MetricFamiliesChecker, error) {
+	return buildCheckers(c.disallowedMetrics, c.allowEmpty, c.metrics, c.vars)
+}
+
+// RunStep runs the hooks of a step, then scrapes the exporter and checks the step's assertions.
+func (c *MetricChecker) RunStep(ctx context.Context, step *Step) (*StepReport, error) {
+	log.FromContext(ctx).Infof("running step %s", step.Name)
+
+	stepReport := &StepReport{
+		Name:    step.Name,
+		Success: true,
+	}
+
+	err := c.SetupRunFixtures(ctx, step.Fixtures)
+	if err != nil {
+		stepReport.Success = false
+		return stepReport, eris.Wrapf(err, "failed to run step: %s", step.Name)
+	}
+
+	if step.Wait > 0 {
+		log.FromContext(ctx).Infof("waiting for %s", step.Wait)
+		err = Sleep(ctx, step.Wait)
+		if err != nil {
+			stepReport.Success = false
+			return stepReport, err
+		}
+	}
+
+	if !step.Scrape {
+		return stepReport, nil
+	}
+
+	metricFamilies, err := c.Scrape(ctx)
+	if err != nil {
+		stepReport.Success = false
+		return stepReport, eris.Wrapf(err, "failed to run step: %s", step.Name)
+	}
+
+	checkers, err := buildCheckers(step.DisallowedMetrics, step.AllowEmpty, step.Metrics, c.vars)
+	if err != nil {
+		stepReport.Success = false
+		return stepReport, eris.Wrapf(err, "failed to run step: %s", step.Name)
+	}
+
+	report, err := runCheckers(ctx, checkers, metricFamilies)
+	stepReport.Success = report.Success
+	stepReport.Metrics = report.Metrics
+	stepReport.Results = report.Results
+
+	return stepReport, err
+}
+
+// fixtureReports returns the reports of the fixtures which ran a command.
+func fixtureReports(fixtures []Fixture, step string) []*FixtureReport {
+	var reports []*FixtureReport
+	for _, fixture := range fixtures {
+		reporting, ok := fixture.(ReportingFixture)
+		if !ok || reporting.Report().Empty() {
+			continue
+		}
+
+		report := reporting.Report()
+		report.Step = step
+		reports = append(reports, report)
+	}
+
+	return reports
+}
+
+// completeReport adds what the fixtures did during the run to the report, a report is created for
+// a run which failed before checking if there is anything to tell.
+func (c *MetricChecker) completeReport(checkReport *CheckReport, checkErr error) *CheckReport {
+	reports := fixtureReports(c.fixtures, "")
+	for _, step := range c.steps {
+		reports = append(reports, fixtureReports(step.Fixtures, step.Name)...)
+	}
+
+	artifacts := make(map[string]string)
+	for _, fixture := range c.fixtures {
+		if artifactsFixture, ok := fixture.(ArtifactsFixture); ok {
+			for name, path := range artifactsFixture.Artifacts() {
+				artifacts[name] = path
+			}
+		}
+	}
+
+	vars := c.vars.Values()
+	onFailure := fixtureReports(c.onFailure, "")
+	if checkReport == nil {
+		if len(reports) == 0 && len(vars) == 0 && len(c.setupStatuses) == 0 && len(onFailure) == 0 &&
+			len(c.teardownStatuses) == 0 && len(artifacts) == 0 {
+			return nil
+		}
+		checkReport = &CheckReport{}
+	}
+
+	checkReport.Fixtures = reports
+	checkReport.Setup = c.setupStatuses
+	checkReport.OnFailure = onFailure
+	checkReport.Teardown = c.teardownStatuses
+	if eris.Is(checkErr, ErrTeardown) {
+		checkReport.Success = false
+	}
+	if len(vars) != 0 {
+		checkReport.Vars = vars
+	}
+	if len(artifacts) != 0 {
+		checkReport.Artifacts = artifacts
+	}
+
+	return checkReport
+}
+
 func (c *MetricChecker) Check(ctx context.Context) (checkReport *CheckReport, checkErr error) {
+	defer func() {
+		checkReport = c.completeReport(checkReport, checkErr)
+	}()
+
 	checkErr = c.Run(ctx, func(ctx context.Context, metricFamilies map[string]*dto.MetricFamily) error {
 		report, err := c.CheckMetrics(ctx, metricFamilies)
 		checkReport = report
+		if report == nil {
+			return err
+		}
+
+		for _, step := range c.steps {
+			stepReport, stepErr := c.RunStep(ctx, step)
+			report.Steps = append(report.Steps, stepReport)
+			if !stepReport.Success {
+				report.Success = false
+			}
+
+			switch eris.Cause(stepErr) {
+			case nil:
+			case ErrCheck:
+				err = ErrCheck
+			default:
+				return stepErr
+			}
+		}
+
+		logsErr := c.CheckLogs(ctx, report)
+		switch eris.Cause(logsErr) {
+		case nil:
+		case ErrCheck:
+			err = ErrCheck
+		default:
+			return logsErr
+		}
+
 		return err
 	})
 	return
@@ -236,11 +710,13 @@ func NewMetricChecker(
 	allowEmpty bool,
 	metrics []MetricsConfig,
 	waitDuration time.Duration,
+	steps []*Step,
 ) *MetricChecker {
 	return &MetricChecker{
 		Runner:            NewRunner(exporter, fixtures, metricPath, waitDuration),
 		disallowedMetrics: disallowedMetrics,
 		allowEmpty:        allowEmpty,
 		metrics:           metrics,
+		steps:             steps,
 	}
 }
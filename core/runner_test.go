@@ -0,0 +1,65 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCheckReport(t *testing.T) {
+	metrics := parseMetricFamilies(t, "# TYPE pg_up gauge\npg_up 1\n")
+
+	suite := NewSuiteReport()
+	suite.Add("a", &CheckReport{Success: true, Metrics: metrics}, nil)
+	suite.Add("b[K=1]", &CheckReport{Success: true, Metrics: metrics}, nil)
+	suiteData, err := suite.Yaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	single := &CheckReport{Success: true, Metrics: metrics}
+	singleData, err := single.Yaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"suite.yml":  suiteData,
+		"single.yml": singleData,
+		"empty.yml":  []byte("success: false\n"),
+	}
+	for name, data := range files {
+		err := os.WriteFile(filepath.Join(dir, name), data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name    string
+		file    string
+		group   string
+		wantErr bool
+	}{
+		{name: "single", file: "single.yml"},
+		{name: "suite", file: "suite.yml", wantErr: true},
+		{name: "suite group", file: "suite.yml", group: "a"},
+		{name: "suite matrix cell", file: "suite.yml", group: "b[K=1]"},
+		{name: "suite unknown group", file: "suite.yml", group: "c", wantErr: true},
+		{name: "single group", file: "single.yml", group: "a", wantErr: true},
+		{name: "no metrics", file: "empty.yml", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			report, err := ReadCheckReport(filepath.Join(dir, c.file), c.group)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("got error %v, want error %v", err, c.wantErr)
+			}
+			if err == nil && report.Metrics["pg_up"] == nil {
+				t.Errorf("metrics not loaded: %v", report.Metrics)
+			}
+		})
+	}
+}
@@ -1,37 +1,331 @@
 package core
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"time"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/google/shlex"
 	"github.com/mrlyc/heracles/log"
 	"github.com/rotisserie/eris"
 )
 
 type ScriptHook struct {
-	Name      string   `mapstructure:"name"`
-	Container string   `mapstructure:"container"`
-	Setup     []string `mapstructure:"setup"`
-	TearDown  []string `mapstructure:"teardown"`
+	Name           string            `mapstructure:"name"`
+	Container      string            `mapstructure:"container"`
+	Setup          []string          `mapstructure:"setup"`
+	TearDown       []string          `mapstructure:"teardown"`
+	Timeout        time.Duration     `mapstructure:"timeout"`
+	CommandTimeout time.Duration     `mapstructure:"command_timeout"`
+	Retries        int               `mapstructure:"retries"`
+	RetryBackoff   time.Duration     `mapstructure:"retry_backoff"`
+	IgnoreErrors   bool              `mapstructure:"ignore_errors"`
+	Stream         bool              `mapstructure:"stream"`
+	Stdin          string            `mapstructure:"stdin"`
+	StdinFile      string            `mapstructure:"stdin_file"`
+	Shell          string            `mapstructure:"shell"`
+	Script         string            `mapstructure:"script"`
+	TearDownScript string            `mapstructure:"teardown_script"`
+	Env            map[string]string `mapstructure:"env"`
+	Outputs        []HookOutput      `mapstructure:"outputs"`
+	DependsOn      []string          `mapstructure:"depends_on"`
+	AlwaysTeardown bool              `mapstructure:"always_teardown"`
+}
+
+// SetupCommands returns the setup commands of the hook, followed by its script.
+func (h ScriptHook) SetupCommands() []string {
+	if h.Script == "" {
+		return h.Setup
+	}
+	return append(append([]string{}, h.Setup...), h.Script)
+}
+
+// TearDownCommands returns the teardown commands of the hook, followed by its teardown script.
+func (h ScriptHook) TearDownCommands() []string {
+	if h.TearDownScript == "" {
+		return h.TearDown
+	}
+	return append(append([]string{}, h.TearDown...), h.TearDownScript)
+}
+
+// Input returns the environment variables and the stdin of the commands of the hook.
+func (h ScriptHook) Input() HookInput {
+	return HookInput{
+		Env:  h.Env,
+		Text: h.Stdin,
+		File: h.StdinFile,
+	}
+}
+
+// Policy returns how the commands of the hook are run.
+func (h ScriptHook) Policy() HookPolicy {
+	backoff := h.RetryBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	// a blank shell falls back to the default
+	shell := strings.TrimSpace(h.Shell)
+	if shell == "" && (h.Script != "" || h.TearDownScript != "") {
+		shell = "sh"
+	}
+
+	return HookPolicy{
+		Timeout:        h.Timeout,
+		CommandTimeout: h.CommandTimeout,
+		Retries:        h.Retries,
+		RetryBackoff:   backoff,
+		IgnoreErrors:   h.IgnoreErrors,
+		Stream:         h.Stream,
+		Shell:          shell,
+	}
+}
+
+// CommandReport records an attempt to run a hook command.
+type CommandReport struct {
+	Command  string `yaml:"command"`
+	Attempt  int    `yaml:"attempt"`
+	Duration string `yaml:"duration"`
+	ExitCode int    `yaml:"exit_code"`
+	Stdout   string `yaml:"stdout,omitempty"`
+	Stderr   string `yaml:"stderr,omitempty"`
+	Error    string `yaml:"error,omitempty"`
+	Ignored  bool   `yaml:"ignored,omitempty"`
+}
+
+// commandOutput captures the output of a command, and streams it to the logs of the context if asked.
+type commandOutput struct {
+	stdout, stderr bytes.Buffer
+	streams        []io.WriteCloser
+}
+
+// Close flushes the streams and records the output in the report.
+func (o *commandOutput) Close(report *CommandReport) {
+	for _, stream := range o.streams {
+		_ = stream.Close()
+	}
+
+	report.Stdout = o.stdout.String()
+	report.Stderr = o.stderr.String()
+}
+
+func newCommandOutput(ctx context.Context, stream bool) *commandOutput {
+	output := &commandOutput{}
+	if stream {
+		stdout, stderr := log.Stdout(ctx), log.Stderr(ctx)
+		output.streams = []io.WriteCloser{stdout, stderr}
+	}
+
+	return output
+}
+
+// writers returns the writers of stdout and stderr, teeing to the streams if any.
+func (o *commandOutput) writers() (io.Writer, io.Writer) {
+	if len(o.streams) == 0 {
+		return &o.stdout, &o.stderr
+	}
+
+	return io.MultiWriter(&o.stdout, o.streams[0]), io.MultiWriter(&o.stderr, o.streams[1])
+}
+
+// FixtureReport records the commands run by a fixture.
+type FixtureReport struct {
+	Name     string           `yaml:"name"`
+	Step     string           `yaml:"step,omitempty"`
+	Setup    []*CommandReport `yaml:"setup,omitempty"`
+	TearDown []*CommandReport `yaml:"teardown,omitempty"`
+}
+
+// Empty tells whether the fixture ran no command.
+func (f *FixtureReport) Empty() bool {
+	return len(f.Setup) == 0 && len(f.TearDown) == 0
+}
+
+// HookInput is what the commands of a hook get, environment variables added to the environment
+// of heracles on the machine or of the container, and a stdin of the setup commands from a text
+// or a file.
+type HookInput struct {
+	Env  map[string]string
+	Text string
+	File string
+}
+
+// Empty tells whether the commands get no stdin.
+func (i HookInput) Empty() bool {
+	return i.Text == "" && i.File == ""
+}
+
+// TearDown returns the input of the teardown commands, which get the environment variables only.
+func (i HookInput) TearDown() HookInput {
+	return HookInput{Env: i.Env}
+}
+
+// Open returns a reader of the input, a file is opened again for every command.
+func (i HookInput) Open() (io.ReadCloser, error) {
+	if i.File == "" {
+		return io.NopCloser(strings.NewReader(i.Text)), nil
+	}
+
+	file, err := os.Open(i.File)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to open stdin file: %s", i.File)
+	}
+
+	return file, nil
+}
+
+// HookPolicy limits and retries the commands of a hook.
+//
+// Timeout limits all the setup or teardown commands of the hook, CommandTimeout limits each
+// attempt of a command. A failed command is retried up to Retries times, the backoff doubling
+// after each attempt. With IgnoreErrors a command failing every attempt does not fail the hook.
+// The output of the commands is captured into their reports, and also logged with Stream.
+// With Shell the commands are run by the shell with `set -e`, instead of being split into arguments.
+type HookPolicy struct {
+	Timeout        time.Duration
+	CommandTimeout time.Duration
+	Retries        int
+	RetryBackoff   time.Duration
+	IgnoreErrors   bool
+	Stream         bool
+	Shell          string
+}
+
+// Args returns the arguments running the command.
+func (p HookPolicy) Args(command string) ([]string, error) {
+	if p.Shell == "" {
+		args, err := shlex.Split(command)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to parse command: %s", command)
+		} else if len(args) == 0 {
+			return nil, eris.New("empty command")
+		}
+		return args, nil
+	}
+
+	args, err := shlex.Split(p.Shell)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to parse shell: %s", p.Shell)
+	} else if len(args) == 0 {
+		return nil, eris.New("empty shell")
+	}
+
+	return append(args, "-c", "set -e\n"+command), nil
+}
+
+// commandRunner runs a command with its arguments and records its exit code and output in the report.
+type commandRunner func(ctx context.Context, command string, args []string, stream bool, report *CommandReport) error
+
+func (p HookPolicy) runCommand(
+	ctx context.Context, reports *[]*CommandReport, command string,
+	run commandRunner,
+) error {
+	args, err := p.Args(command)
+	if err != nil {
+		*reports = append(*reports, &CommandReport{Command: command, Attempt: 1, Error: err.Error()})
+		return err
+	}
+
+	backoff := p.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		commandCtx, cancel := ctx, context.CancelFunc(func() {})
+		if p.CommandTimeout > 0 {
+			commandCtx, cancel = context.WithTimeout(ctx, p.CommandTimeout)
+		}
+
+		report := &CommandReport{
+			Command: command,
+			Attempt: attempt,
+		}
+		*reports = append(*reports, report)
+
+		started := time.Now()
+		err := run(commandCtx, command, args, p.Stream, report)
+		if err != nil && eris.Is(commandCtx.Err(), context.DeadlineExceeded) {
+			err = eris.Wrapf(err, "command timed out: %s", command)
+		}
+		cancel()
+		report.Duration = time.Since(started).String()
+
+		if err == nil {
+			return nil
+		}
+
+		report.Error = err.Error()
+		if !p.Stream && report.Stderr != "" {
+			log.FromContext(ctx).Errorf("command %s failed, stderr: %s", command, strings.TrimSpace(report.Stderr))
+		}
+		if attempt > p.Retries || ctx.Err() != nil {
+			return err
+		}
+
+		log.FromContext(ctx).Warnf("command %s failed, retrying in %s (%d/%d): %v", command, backoff, attempt, p.Retries, err)
+		if err := Sleep(ctx, backoff); err != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// Run runs the commands in order, recording every attempt in the reports.
+func (p HookPolicy) Run(
+	ctx context.Context, reports *[]*CommandReport, commands []string,
+	run commandRunner,
+) error {
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	for _, command := range commands {
+		err := p.runCommand(ctx, reports, command, run)
+		if err == nil {
+			continue
+		}
+
+		if !p.IgnoreErrors {
+			return err
+		}
+
+		log.FromContext(ctx).Warnf("ignoring error of command %s: %v", command, err)
+		(*reports)[len(*reports)-1].Ignored = true
+	}
+
+	return nil
 }
 
 func RunScript(ctx context.Context, command string) error {
-	commands, err := shlex.Split(command)
+	args, err := HookPolicy{}.Args(command)
 	if err != nil {
-		return eris.Wrapf(err, "failed to parse command: %s", command)
+		return err
+	}
+
+	return runScript(ctx, args, nil, os.Stdin, true, &CommandReport{Command: command})
+}
+
+func runScript(ctx context.Context, args, env []string, stdin io.Reader, stream bool, report *CommandReport) error {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if len(env) != 0 {
+		cmd.Env = append(os.Environ(), env...)
 	}
 
-	cmd := exec.CommandContext(ctx, commands[0], commands[1:]...)
+	output := newCommandOutput(ctx, stream)
+	defer output.Close(report)
 
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdin = stdin
+	cmd.Stdout, cmd.Stderr = output.writers()
 
-	if err := cmd.Run(); err != nil {
+	err := cmd.Run()
+	report.ExitCode = cmd.ProcessState.ExitCode()
+	if err != nil {
 		return eris.Wrap(err, "failed to run script")
 	}
 
@@ -52,6 +346,47 @@ type ScriptFixture struct {
 	Name             string
 	SetupCommands    []string
 	TeardownCommands []string
+	Policy           HookPolicy
+	Input            HookInput
+	Vars             *HookVars
+	Outputs          []HookOutput
+	Dependencies     []string
+	Always           bool
+	report           *FixtureReport
+}
+
+func (s ScriptFixture) GetName() string {
+	return s.Name
+}
+
+func (s ScriptFixture) AlwaysTearDown() bool {
+	return s.Always
+}
+
+func (s ScriptFixture) DependsOn() []string {
+	return s.Dependencies
+}
+
+// run renders the commands and runs them on the machine.
+func (s ScriptFixture) run(ctx context.Context, reports *[]*CommandReport, commands []string, input HookInput) error {
+	commands, env, err := s.Vars.Render(ctx, commands, input.Env)
+	if err != nil {
+		return err
+	}
+
+	return s.Policy.Run(ctx, reports, commands, func(ctx context.Context, command string, args []string, stream bool, report *CommandReport) error {
+		if input.Empty() {
+			return runScript(ctx, args, env, os.Stdin, stream, report)
+		}
+
+		stdin, err := input.Open()
+		if err != nil {
+			return err
+		}
+		defer stdin.Close()
+
+		return runScript(ctx, args, env, stdin, stream, report)
+	})
 }
 
 func (s ScriptFixture) String() string {
@@ -63,8 +398,14 @@ func (s ScriptFixture) Setup(ctx context.Context) error {
 		return nil
 	}
 
-	log.Debugf("running setup fixture: %v", s)
-	return RunScripts(ctx, s.SetupCommands)
+	log.FromContext(ctx).Debugf("running setup fixture: %v", s)
+	attempts := len(s.report.Setup)
+	err := s.run(ctx, &s.report.Setup, s.SetupCommands, s.Input)
+	if err != nil {
+		return err
+	}
+
+	return s.Vars.captureOutputs(s.Outputs, len(s.SetupCommands), s.report.Setup[attempts:])
 }
 
 func (s ScriptFixture) TearDown(ctx context.Context) error {
@@ -72,15 +413,29 @@ func (s ScriptFixture) TearDown(ctx context.Context) error {
 		return nil
 	}
 
-	log.Debugf("running teardown fixture: %v", s)
-	return RunScripts(ctx, s.TeardownCommands)
+	log.FromContext(ctx).Debugf("running teardown fixture: %v", s)
+	return s.run(ctx, &s.report.TearDown, s.TeardownCommands, s.Input.TearDown())
 }
 
-func NewScriptFixture(name string, setup, teardown []string) *ScriptFixture {
+func (s ScriptFixture) Report() *FixtureReport {
+	return s.report
+}
+
+func NewScriptFixture(
+	name string, setup, teardown []string, policy HookPolicy, input HookInput, vars *HookVars, outputs []HookOutput,
+	dependsOn []string, alwaysTearDown bool,
+) *ScriptFixture {
 	return &ScriptFixture{
 		Name:             name,
 		SetupCommands:    setup,
 		TeardownCommands: teardown,
+		Policy:           policy,
+		Input:            input,
+		Vars:             vars,
+		Outputs:          outputs,
+		Dependencies:     dependsOn,
+		Always:           alwaysTearDown,
+		report:           &FixtureReport{Name: name},
 	}
 }
 
@@ -90,65 +445,167 @@ type ContainerScriptFixture struct {
 	Container        string
 	SetupCommands    []string
 	TeardownCommands []string
+	Policy           HookPolicy
+	Input            HookInput
+	Vars             *HookVars
+	Outputs          []HookOutput
+	Dependencies     []string
+	Always           bool
+	report           *FixtureReport
+}
+
+func (c *ContainerScriptFixture) GetName() string {
+	return c.Name
+}
+
+func (c *ContainerScriptFixture) AlwaysTearDown() bool {
+	return c.Always
+}
+
+func (c *ContainerScriptFixture) DependsOn() []string {
+	return c.Dependencies
 }
 
 func (c *ContainerScriptFixture) String() string {
 	return fmt.Sprintf("ContainerScriptFixture{Name: %s, Container: %s, SetupCommands: %v, TeardownCommands: %v}", c.Name, c.Container, c.SetupCommands, c.TeardownCommands)
 }
 
-func (c *ContainerScriptFixture) runInContainer(ctx context.Context, scripts []string) error {
-	if len(scripts) == 0 {
-		return nil
+// exec runs a command in the container, feeding the input to its stdin and demultiplexing
+// its stdout and stderr, it returns the exit code of the command.
+func (c *ContainerScriptFixture) exec(ctx context.Context, id string, cmd, env []string, input HookInput, stdout, stderr io.Writer) (int, error) {
+	dockerClient, err := c.dockerCompose.DockerClient(ctx)
+	if err != nil {
+		return 0, err
 	}
 
-	container, err := c.dockerCompose.ServiceContainer(ctx, c.Container)
+	created, err := dockerClient.ContainerExecCreate(ctx, id, types.ExecConfig{
+		Cmd:          cmd,
+		Env:          env,
+		AttachStdin:  !input.Empty(),
+		AttachStdout: true,
+		AttachStderr: true,
+	})
 	if err != nil {
-		return eris.Wrap(err, "failed to get container")
+		return 0, eris.Wrap(err, "failed to create exec")
 	}
 
-	for _, script := range scripts {
-		scripts, err := shlex.Split(script)
-		if err != nil {
-			return eris.Wrapf(err, "failed to parse script: %s", script)
+	hijacked, err := dockerClient.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{})
+	if err != nil {
+		return 0, eris.Wrap(err, "failed to attach exec")
+	}
+	defer hijacked.Close()
+
+	// the attached stream does not follow the context, close it to stop reading
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			hijacked.Close()
+		case <-done:
 		}
+	}()
 
-		code, reader, err := container.Exec(ctx, scripts)
+	if !input.Empty() {
+		stdin, err := input.Open()
 		if err != nil {
-			return eris.Wrapf(err, "failed to exec script: %s", script)
+			return 0, err
 		}
 
-		output := os.Stderr
-		if code == 0 {
-			output = os.Stdout
-		}
+		go func() {
+			defer stdin.Close()
+			// the command may exit without reading its input
+			_, _ = io.Copy(hijacked.Conn, stdin)
+			_ = hijacked.CloseWrite()
+		}()
+	}
 
-		scanner := bufio.NewScanner(reader)
-		for scanner.Scan() {
-			_, _ = fmt.Fprintln(output, scanner.Text())
-		}
+	_, err = stdcopy.StdCopy(stdout, stderr, hijacked.Reader)
+	if ctx.Err() != nil {
+		return 0, eris.Wrap(ctx.Err(), "exec interrupted")
+	} else if err != nil {
+		return 0, eris.Wrap(err, "failed to read exec output")
+	}
 
-		if code != 0 {
-			return eris.Errorf("failed to exec script: %s, code: %d", script, code)
-		}
+	inspect, err := dockerClient.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return 0, eris.Wrap(err, "failed to inspect exec")
+	}
+
+	return inspect.ExitCode, nil
+}
+
+// runInContainer runs a script in the container, a timed out exec is abandoned but the
+// process may keep running in the container.
+func (c *ContainerScriptFixture) runInContainer(ctx context.Context, script string, args, env []string, input HookInput, stream bool, report *CommandReport) error {
+	container, err := c.dockerCompose.ServiceContainer(ctx, c.Container)
+	if err != nil {
+		return eris.Wrap(err, "failed to get container")
+	}
+
+	output := newCommandOutput(ctx, stream)
+	stdout, stderr := output.writers()
+	code, err := c.exec(ctx, container.GetContainerID(), args, env, input, stdout, stderr)
+	output.Close(report)
+	if err != nil {
+		return eris.Wrapf(err, "failed to exec script: %s", script)
+	}
+
+	report.ExitCode = code
+	if code != 0 {
+		return eris.Errorf("failed to exec script: %s, code: %d", script, code)
 	}
 
 	return nil
 }
 
+// run renders the commands and runs them in the container.
+func (c *ContainerScriptFixture) run(ctx context.Context, reports *[]*CommandReport, commands []string, input HookInput) error {
+	commands, env, err := c.Vars.Render(ctx, commands, input.Env)
+	if err != nil {
+		return err
+	}
+
+	return c.Policy.Run(ctx, reports, commands, func(ctx context.Context, command string, args []string, stream bool, report *CommandReport) error {
+		return c.runInContainer(ctx, command, args, env, input, stream, report)
+	})
+}
+
 func (c *ContainerScriptFixture) Setup(ctx context.Context) error {
-	return c.runInContainer(ctx, c.SetupCommands)
+	attempts := len(c.report.Setup)
+	err := c.run(ctx, &c.report.Setup, c.SetupCommands, c.Input)
+	if err != nil {
+		return err
+	}
+
+	return c.Vars.captureOutputs(c.Outputs, len(c.SetupCommands), c.report.Setup[attempts:])
 }
 
 func (c *ContainerScriptFixture) TearDown(ctx context.Context) error {
-	return c.runInContainer(ctx, c.TeardownCommands)
+	return c.run(ctx, &c.report.TearDown, c.TeardownCommands, c.Input.TearDown())
+}
+
+func (c *ContainerScriptFixture) Report() *FixtureReport {
+	return c.report
 }
 
-func NewContainerScriptFixture(dockerCompose *DockerCompose, name, container string, setup, teardown []string) *ContainerScriptFixture {
+func NewContainerScriptFixture(
+	dockerCompose *DockerCompose, name, container string, setup, teardown []string,
+	policy HookPolicy, input HookInput, vars *HookVars, outputs []HookOutput, dependsOn []string,
+	alwaysTearDown bool,
+) *ContainerScriptFixture {
 	return &ContainerScriptFixture{
 		dockerCompose:    dockerCompose,
 		Name:             name,
 		Container:        container,
 		SetupCommands:    setup,
 		TeardownCommands: teardown,
+		Policy:           policy,
+		Input:            input,
+		Vars:             vars,
+		Outputs:          outputs,
+		Dependencies:     dependsOn,
+		Always:           alwaysTearDown,
+		report:           &FixtureReport{Name: name},
 	}
 }
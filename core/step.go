@@ -0,0 +1,53 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// StepConfig is a scenario step of a config group.
+type StepConfig struct {
+	Name              string                `mapstructure:"name"`
+	Actions           []ServiceActionConfig `mapstructure:"actions"`
+	NetworkFaults     []NetworkFaultConfig  `mapstructure:"network_faults"`
+	Hooks             []ScriptHook          `mapstructure:"hooks"`
+	Wait              time.Duration         `mapstructure:"wait"`
+	Scrape            *bool                 `mapstructure:"scrape"`
+	AllowEmpty        bool                  `mapstructure:"allow_empty"`
+	DisallowedMetrics []string              `mapstructure:"disallowed_metrics"`
+	Metrics           []MetricsConfig       `mapstructure:"metrics"`
+}
+
+// Step runs its fixtures (service actions, network faults, then hooks), waits, then scrapes the
+// exporter again and checks its own assertions. The fixtures of a step are torn down along with
+// the fixtures of the run, so later steps see the changes made by earlier ones.
+type Step struct {
+	Name              string
+	Fixtures          []Fixture
+	Wait              time.Duration
+	Scrape            bool
+	AllowEmpty        bool
+	DisallowedMetrics []string
+	Metrics           []MetricsConfig
+}
+
+func (s *Step) String() string {
+	return fmt.Sprintf("Step{Name: %s}", s.Name)
+}
+
+func NewStep(config StepConfig, fixtures []Fixture) *Step {
+	scrape := true
+	if config.Scrape != nil {
+		scrape = *config.Scrape
+	}
+
+	return &Step{
+		Name:              config.Name,
+		Fixtures:          fixtures,
+		Wait:              config.Wait,
+		Scrape:            scrape,
+		AllowEmpty:        config.AllowEmpty,
+		DisallowedMetrics: config.DisallowedMetrics,
+		Metrics:           config.Metrics,
+	}
+}
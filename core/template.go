@@ -0,0 +1,308 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/rotisserie/eris"
+)
+
+// HookVars renders the commands and environment variables of hooks as text/template, so that
+// hooks on the machine can find the services without hard-coded ports:
+//
+//	{{ .Group }}                   the config group
+//	{{ .Project }}                 the compose project name
+//	{{ .Endpoint }}                the base url of the exporter
+//	{{ .Port "postgres" 5432 }}    the host port mapped to a container port of a compose service
+//	{{ .Var "name" }}              an output of a hook which ran before
+//
+// It also keeps the outputs of hooks, which metric samples may assert with value_from.
+type HookVars struct {
+	group         string
+	dockerCompose *DockerCompose
+	exporter      Exporter
+
+	valuesLock sync.RWMutex
+	values     map[string]string
+}
+
+// Set stores an output of a hook.
+func (v *HookVars) Set(name, value string) {
+	v.valuesLock.Lock()
+	defer v.valuesLock.Unlock()
+
+	v.values[name] = value
+}
+
+// Get returns an output of a hook.
+func (v *HookVars) Get(name string) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+
+	v.valuesLock.RLock()
+	defer v.valuesLock.RUnlock()
+
+	value, ok := v.values[name]
+	return value, ok
+}
+
+// Values returns a copy of the outputs of hooks.
+func (v *HookVars) Values() map[string]string {
+	if v == nil {
+		return nil
+	}
+
+	v.valuesLock.RLock()
+	defer v.valuesLock.RUnlock()
+
+	values := make(map[string]string, len(v.values))
+	for name, value := range v.values {
+		values[name] = value
+	}
+
+	return values
+}
+
+// Float returns an output of a hook as a metric value.
+func (v *HookVars) Float(name string) (float64, error) {
+	value, ok := v.Get(name)
+	if !ok {
+		return 0, eris.Errorf("unknown hook output: %s", name)
+	}
+
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, eris.Wrapf(err, "hook output %s is not a number: %q", name, value)
+	}
+
+	return parsed, nil
+}
+
+// hookTemplateData is the data of a template, it resolves the values with the context of the hook.
+type hookTemplateData struct {
+	*HookVars
+	ctx context.Context
+}
+
+func (d hookTemplateData) Group() string {
+	return d.group
+}
+
+func (d hookTemplateData) Project() string {
+	if d.dockerCompose == nil {
+		return ""
+	}
+	return d.dockerCompose.ProjectName
+}
+
+func (d hookTemplateData) Endpoint() (string, error) {
+	if d.exporter == nil {
+		return "", eris.New("no exporter")
+	}
+
+	endpoint, err := d.exporter.Start(d.ctx)
+	if err != nil {
+		return "", eris.Wrap(err, "failed to get exporter endpoint")
+	}
+
+	return endpoint, nil
+}
+
+func (d hookTemplateData) Var(name string) (string, error) {
+	value, ok := d.Get(name)
+	if !ok {
+		return "", eris.Errorf("unknown hook output: %s", name)
+	}
+	return value, nil
+}
+
+func (d hookTemplateData) Port(service string, port interface{}) (string, error) {
+	if d.dockerCompose == nil {
+		return "", eris.New("no compose stack")
+	}
+
+	container, err := d.dockerCompose.ServiceContainer(d.ctx, service)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to get container of service: %s", service)
+	}
+
+	mappedPort, err := container.MappedPort(d.ctx, nat.Port(fmt.Sprint(port)))
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to get mapped port %v of service: %s", port, service)
+	}
+
+	return mappedPort.Port(), nil
+}
+
+func (v *HookVars) render(data hookTemplateData, text string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("hook").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to parse template: %s", text)
+	}
+
+	var rendered strings.Builder
+	err = tmpl.Execute(&rendered, data)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to render template: %s", text)
+	}
+
+	return rendered.String(), nil
+}
+
+// Render renders the commands and the environment variables, which are returned as KEY=VALUE.
+// A nil HookVars returns them as they are.
+func (v *HookVars) Render(ctx context.Context, commands []string, env map[string]string) ([]string, []string, error) {
+	renderedEnv := make([]string, 0, len(env))
+	for key, value := range env {
+		renderedEnv = append(renderedEnv, key+"="+value)
+	}
+	sort.Strings(renderedEnv)
+
+	if v == nil {
+		return commands, renderedEnv, nil
+	}
+
+	data := hookTemplateData{HookVars: v, ctx: ctx}
+
+	renderedCommands := make([]string, 0, len(commands))
+	for _, command := range commands {
+		rendered, err := v.render(data, command)
+		if err != nil {
+			return nil, nil, err
+		}
+		renderedCommands = append(renderedCommands, rendered)
+	}
+
+	for i, item := range renderedEnv {
+		rendered, err := v.render(data, item)
+		if err != nil {
+			return nil, nil, err
+		}
+		renderedEnv[i] = rendered
+	}
+
+	return renderedCommands, renderedEnv, nil
+}
+
+func NewHookVars(group string, dockerCompose *DockerCompose, exporter Exporter) *HookVars {
+	return &HookVars{
+		group:         group,
+		dockerCompose: dockerCompose,
+		exporter:      exporter,
+		values:        make(map[string]string),
+	}
+}
+
+// HookOutput extracts a value from the stdout of a setup command of a hook, the last one by
+// default. The value is the trimmed stdout, the first group (or the match) of a regex, or the
+// value at a dotted path like `items.0.count` of a JSON stdout.
+type HookOutput struct {
+	Name    string `mapstructure:"name"`
+	Command *int   `mapstructure:"command"`
+	Regex   string `mapstructure:"regex"`
+	JSON    string `mapstructure:"json"`
+}
+
+// Extract returns the value from the stdout.
+func (o HookOutput) Extract(stdout string) (string, error) {
+	switch {
+	case o.Regex != "":
+		pattern, err := regexp.Compile(o.Regex)
+		if err != nil {
+			return "", eris.Wrapf(err, "invalid regex of hook output: %s", o.Name)
+		}
+
+		match := pattern.FindStringSubmatch(stdout)
+		if match == nil {
+			return "", eris.Errorf("regex of hook output %s matches nothing", o.Name)
+		} else if len(match) > 1 {
+			return match[1], nil
+		}
+		return match[0], nil
+	case o.JSON != "":
+		var value interface{}
+		err := json.Unmarshal([]byte(stdout), &value)
+		if err != nil {
+			return "", eris.Wrapf(err, "failed to parse json of hook output: %s", o.Name)
+		}
+
+		for _, key := range strings.Split(o.JSON, ".") {
+			switch node := value.(type) {
+			case map[string]interface{}:
+				value = node[key]
+			case []interface{}:
+				index, err := strconv.Atoi(key)
+				if err != nil || index < 0 || index >= len(node) {
+					return "", eris.Errorf("invalid index %s of hook output: %s", key, o.Name)
+				}
+				value = node[index]
+			default:
+				return "", eris.Errorf("path %s of hook output %s not found", o.JSON, o.Name)
+			}
+		}
+
+		switch value := value.(type) {
+		case nil:
+			return "", eris.Errorf("path %s of hook output %s not found", o.JSON, o.Name)
+		case string:
+			return value, nil
+		default:
+			data, _ := json.Marshal(value)
+			return string(data), nil
+		}
+	default:
+		return strings.TrimSpace(stdout), nil
+	}
+}
+
+// captureOutputs stores the outputs extracted from the last attempts of the setup commands.
+func (v *HookVars) captureOutputs(outputs []HookOutput, commands int, reports []*CommandReport) error {
+	if len(outputs) == 0 {
+		return nil
+	} else if v == nil {
+		return eris.New("hook outputs are not kept")
+	}
+
+	// the attempts of a command follow each other, the first one starts a new command
+	lastAttempts := make([]*CommandReport, 0, commands)
+	for _, report := range reports {
+		if report.Attempt == 1 {
+			lastAttempts = append(lastAttempts, report)
+		} else if len(lastAttempts) > 0 {
+			lastAttempts[len(lastAttempts)-1] = report
+		}
+	}
+
+	for _, output := range outputs {
+		index := commands - 1
+		if output.Command != nil {
+			index = *output.Command
+		}
+
+		if index < 0 || index >= len(lastAttempts) {
+			return eris.Errorf("no setup command %d for hook output: %s", index, output.Name)
+		}
+
+		value, err := output.Extract(lastAttempts[index].Stdout)
+		if err != nil {
+			return err
+		}
+
+		v.Set(output.Name, value)
+	}
+
+	return nil
+}
@@ -1,7 +1,11 @@
 package log
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -222,3 +226,112 @@ func Warningln(args ...interface{}) {
 func Warnln(args ...interface{}) {
 	defaultLogger.Warnln(args...)
 }
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	prefixKey
+)
+
+// prefixWriter writes complete lines to the underlying writer, each one starting with a prefix.
+type prefixWriter struct {
+	lock   sync.Mutex
+	writer io.Writer
+	prefix []byte
+	buffer []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.buffer = append(w.buffer, p...)
+	for {
+		index := bytes.IndexByte(w.buffer, '\n')
+		if index < 0 {
+			break
+		}
+
+		line := make([]byte, 0, len(w.prefix)+index+1)
+		line = append(line, w.prefix...)
+		line = append(line, w.buffer[:index+1]...)
+		w.buffer = w.buffer[index+1:]
+
+		if _, err := w.writer.Write(line); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close writes out the pending partial line.
+func (w *prefixWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if len(w.buffer) == 0 {
+		return nil
+	}
+
+	line := append(append([]byte{}, w.prefix...), w.buffer...)
+	w.buffer = nil
+
+	_, err := w.writer.Write(append(line, '\n'))
+	return err
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// NewPrefixWriter returns a writer which prefixes every line written to w, the last
+// partial line is written on Close.
+func NewPrefixWriter(w io.Writer, prefix string) io.WriteCloser {
+	return &prefixWriter{
+		writer: w,
+		prefix: []byte(prefix),
+	}
+}
+
+// WithPrefix returns a context whose logger and outputs prefix every line, used to tell
+// apart the interleaved output of concurrent runs.
+func WithPrefix(ctx context.Context, prefix string) context.Context {
+	logger := newLogrusLogger(viper.GetViper())
+	logger.Out = NewPrefixWriter(logger.Out, prefix)
+
+	ctx = context.WithValue(ctx, loggerKey, logger)
+	return context.WithValue(ctx, prefixKey, prefix)
+}
+
+// FromContext returns the logger of the context, or the default logger.
+func FromContext(ctx context.Context) Logger {
+	logger, ok := ctx.Value(loggerKey).(Logger)
+	if !ok {
+		return defaultLogger
+	}
+	return logger
+}
+
+// Stdout returns the standard output of the context, it should be closed after use.
+func Stdout(ctx context.Context) io.WriteCloser {
+	prefix, ok := ctx.Value(prefixKey).(string)
+	if !ok {
+		return nopCloser{os.Stdout}
+	}
+	return NewPrefixWriter(os.Stdout, prefix)
+}
+
+// Stderr returns the standard error of the context, it should be closed after use.
+func Stderr(ctx context.Context) io.WriteCloser {
+	prefix, ok := ctx.Value(prefixKey).(string)
+	if !ok {
+		return nopCloser{os.Stderr}
+	}
+	return NewPrefixWriter(os.Stderr, prefix)
+}